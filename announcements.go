@@ -0,0 +1,291 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	goingReaction    = "✅"
+	maybeReaction    = "❔"
+	notGoingReaction = "❌"
+
+	announcementColor = 0x3498db
+	cancelledColor    = 0x95a5a6
+
+	// Discord rejects embed fields longer than this
+	maxEmbedFieldLength = 1024
+)
+
+var (
+	// The reactions added to an announcement, in order, and the RSVP status each one stands for
+	rsvpReactions      = []string{goingReaction, maybeReaction, notGoingReaction}
+	rsvpReactionStatus = map[string]string{
+		goingReaction:    "Going",
+		maybeReaction:    "Maybe",
+		notGoingReaction: "Not going",
+	}
+)
+
+// Post an embed for a new Event to its guild's announcement channel and add the reactions people RSVP with
+// Does nothing if the guild hasn't set an announcement channel
+func AnnounceEvent(s *discordgo.Session, guildID string, event *Event) error {
+	channelID, err := RetrieveGuildAnnounceChannel(guildID)
+	if err != nil || channelID == "" {
+		return err
+	}
+
+	embed, err := announcementEmbed(event, time.Now())
+	if err != nil {
+		return err
+	}
+	message, err := s.ChannelMessageSendEmbed(channelID, embed)
+	if err != nil {
+		return err
+	}
+	for _, emoji := range rsvpReactions {
+		err = s.MessageReactionAdd(channelID, message.ID, emoji)
+		if err != nil {
+			return err
+		}
+	}
+
+	event.announceChannelID = channelID
+	event.announceMessageID = message.ID
+	return UpdateEventAnnouncement(strconv.FormatInt(event.id, 10), channelID, message.ID)
+}
+
+// Redraw an Event's announcement with its current details and RSVPs, if it was announced
+func RefreshAnnouncement(s *discordgo.Session, eventID string) {
+	event, err := eventStore.RetrieveEventByID(eventID)
+	if err != nil || event.announceMessageID == "" {
+		return
+	}
+
+	embed, err := announcementEmbed(event, time.Now())
+	if err != nil {
+		fmt.Println("Error building announcement: " + err.Error())
+		return
+	}
+	_, err = s.ChannelMessageEditEmbed(event.announceChannelID, event.announceMessageID, embed)
+	if err != nil {
+		fmt.Println("Error updating announcement: " + err.Error())
+	}
+}
+
+// Mark an Event's announcement as cancelled and remove its reactions so nobody can RSVP to it any more
+func CloseAnnouncement(s *discordgo.Session, event *Event) {
+	if event.announceMessageID == "" {
+		return
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:       "Cancelled: " + event.name,
+		Description: "This event has been cancelled.",
+		Color:       cancelledColor,
+	}
+	_, err := s.ChannelMessageEditEmbed(event.announceChannelID, event.announceMessageID, embed)
+	if err != nil {
+		fmt.Println("Error updating announcement: " + err.Error())
+		return
+	}
+	s.MessageReactionsRemoveAll(event.announceChannelID, event.announceMessageID)
+}
+
+// Redraw a restored Event's announcement and put back the reactions people RSVP with
+func ReopenAnnouncement(s *discordgo.Session, event *Event) {
+	if event.announceMessageID == "" {
+		return
+	}
+
+	RefreshAnnouncement(s, strconv.FormatInt(event.id, 10))
+	for _, emoji := range rsvpReactions {
+		err := s.MessageReactionAdd(event.announceChannelID, event.announceMessageID, emoji)
+		if err != nil {
+			fmt.Println("Error adding reaction: " + err.Error())
+			return
+		}
+	}
+}
+
+// Record an RSVP for someone who reacted to an Event's announcement.  Reactions to a recurring Event are for its next
+// occurrence.  Removing a reaction takes back the RSVP it made, unless the person has since picked something else.
+func HandleAnnouncementReaction(s *discordgo.Session, reaction *discordgo.MessageReaction, added bool) {
+	if s.State.User != nil && reaction.UserID == s.State.User.ID {
+		return
+	}
+	status, ok := rsvpReactionStatus[reaction.Emoji.Name]
+	if !ok {
+		return
+	}
+
+	event, err := eventStore.RetrieveEventByAnnouncement(reaction.MessageID)
+	if err != nil || event.status == EventCancelled {
+		// Not an announcement, or not one anyone can RSVP to any more
+		return
+	}
+	occurrence, err := NextOccurrence(event, time.Now())
+	if err != nil {
+		return
+	}
+
+	idStr := strconv.FormatInt(event.id, 10)
+	rsvps, err := eventStore.RetrieveRSVPs(idStr, occurrence.occurrence)
+	if err != nil {
+		fmt.Println("Error retrieving RSVPs: " + err.Error())
+		return
+	}
+	var existing *RSVP
+	for _, rsvp := range rsvps {
+		if rsvp.userID == reaction.UserID {
+			existing = rsvp
+			break
+		}
+	}
+
+	var rsvp *RSVP
+	if added {
+		if existing != nil {
+			rsvp, err = eventStore.UpdateRSVP(strconv.FormatInt(existing.id, 10), status)
+		} else {
+			var user *discordgo.User
+			user, err = s.User(reaction.UserID)
+			if err == nil {
+				rsvp, err = eventStore.CreateRSVP(idStr, occurrence.occurrence, user.Username, user.ID, status)
+			}
+		}
+	} else {
+		if existing == nil || existing.status == "Not going" {
+			return
+		}
+		if existing.status != status && !(existing.status == "Waitlisted" && status == "Going") {
+			return
+		}
+		rsvp, err = eventStore.UpdateRSVP(strconv.FormatInt(existing.id, 10), "Not going")
+	}
+	if err != nil {
+		fmt.Println("Error recording RSVP from reaction: " + err.Error())
+		return
+	}
+
+	if added {
+		// Only leave the reaction for the choice they just made so the announcement shows one answer per person
+		for _, emoji := range rsvpReactions {
+			if emoji != reaction.Emoji.Name {
+				s.MessageReactionRemove(reaction.ChannelID, reaction.MessageID, emoji, reaction.UserID)
+			}
+		}
+		if rsvp.status == "Waitlisted" {
+			channel, channelErr := s.UserChannelCreate(reaction.UserID)
+			if channelErr == nil {
+				s.ChannelMessageSend(channel.ID, occurrence.name+" is full, so you've been added to the waitlist.  "+
+					"You'll get a message if a spot opens up.")
+			}
+		}
+	}
+
+	// Someone who was going may have given up their spot
+	promoted, err := eventStore.PromoteWaitlist(idStr, occurrence.occurrence)
+	if err != nil {
+		fmt.Println("Error promoting waitlist: " + err.Error())
+	} else {
+		notifyPromoted(s, occurrence, promoted)
+	}
+
+	RefreshAnnouncement(s, idStr)
+}
+
+// Build the embed for an Event's announcement, showing its next occurrence if it repeats
+func announcementEmbed(event *Event, now time.Time) (*discordgo.MessageEmbed, error) {
+	occurrence, err := NextOccurrence(event, now)
+	if err != nil {
+		return nil, err
+	}
+	rsvps, err := eventStore.RetrieveRSVPs(strconv.FormatInt(event.id, 10), occurrence.occurrence)
+	if err != nil {
+		return nil, err
+	}
+
+	var going, maybe, waitlisted []string
+	for _, rsvp := range rsvps {
+		switch rsvp.status {
+		case "Going":
+			going = append(going, rsvp.username)
+		case "Maybe":
+			maybe = append(maybe, rsvp.username)
+		case "Waitlisted":
+			waitlisted = append(waitlisted, rsvp.username)
+		}
+	}
+
+	goingTitle := "Going (" + strconv.Itoa(len(going)) + ")"
+	if occurrence.maxAttendees != 0 {
+		goingTitle = "Going (" + strconv.Itoa(len(going)) + "/" + strconv.FormatInt(occurrence.maxAttendees, 10) + ")"
+	}
+
+	fields := []*discordgo.MessageEmbedField{
+		{Name: "When", Value: occurrence.When()},
+		{Name: "Where", Value: embedValue(occurrence.location)},
+	}
+	if occurrence.recurrence != nil {
+		fields = append(fields, &discordgo.MessageEmbedField{
+			Name:  "Repeats",
+			Value: occurrence.recurrence.Describe(LoadTimezone(occurrence.timezone)),
+		})
+	}
+	fields = append(fields,
+		&discordgo.MessageEmbedField{Name: goingTitle, Value: embedNames(going), Inline: true},
+		&discordgo.MessageEmbedField{Name: "Maybe (" + strconv.Itoa(len(maybe)) + ")", Value: embedNames(maybe),
+			Inline: true})
+	if len(waitlisted) > 0 {
+		fields = append(fields, &discordgo.MessageEmbedField{
+			Name:   "Waitlist (" + strconv.Itoa(len(waitlisted)) + ")",
+			Value:  embedNames(waitlisted),
+			Inline: true,
+		})
+	}
+
+	return &discordgo.MessageEmbed{
+		Title:       occurrence.name,
+		Description: occurrence.description,
+		Color:       announcementColor,
+		Fields:      fields,
+		Footer: &discordgo.MessageEmbedFooter{
+			Text: "Event ID " + strconv.FormatInt(event.id, 10) + " • Created by " + event.creator + "\n" +
+				"RSVP by reacting: " + goingReaction + " Going  " + maybeReaction + " Maybe  " +
+				notGoingReaction + " Not going",
+		},
+	}, nil
+}
+
+// List names for an embed field, cutting the list short if it would be too long for Discord
+func embedNames(names []string) string {
+	if len(names) == 0 {
+		return "Nobody yet"
+	}
+
+	value := ""
+	for i, name := range names {
+		more := "\n…and " + strconv.Itoa(len(names)-i) + " more"
+		if len(value)+len(name)+1+len(more) > maxEmbedFieldLength {
+			return value + more
+		}
+		if value != "" {
+			value += "\n"
+		}
+		value += name
+	}
+	return value
+}
+
+// Discord rejects embed fields with empty values
+func embedValue(value string) string {
+	if strings.TrimSpace(value) == "" {
+		return "-"
+	}
+	return value
+}
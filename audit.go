@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// What a change in an Event's history did
+const (
+	AuditCreate  = "create"
+	AuditEdit    = "edit"
+	AuditCancel  = "cancel"
+	AuditRestore = "restore"
+	AuditRSVP    = "rsvp"
+	AuditCohost  = "cohost"
+
+	// How many changes !event history looks at, and how much of each value it shows
+	historyLimit       = 50
+	historyValueLength = 40
+
+	// Discord rejects messages longer than 2000 characters, so !event history stops adding changes before then
+	historyMessageLength = 1900
+
+	// How !event history shows an Event's start time, shorter than eventTimeLayout
+	historyTimeLayout = "Mon Jan 2 3:04 PM"
+)
+
+// What each column that can be edited is called in !event history
+var auditFieldNames = map[string]string{
+	"name":          "name",
+	"description":   "description",
+	"location":      "location",
+	"starts_at":     "time",
+	"max_attendees": "maximum attendees",
+	"recurrence":    "repeat schedule",
+	"creator_id":    "owner",
+}
+
+// An AuditEntry is one change to an Event or to an RSVP to it, kept so people can see who changed what
+type AuditEntry struct {
+	id         int64
+	eventID    int64
+	occurrence int64  // 0 unless only one occurrence of a recurring Event was changed
+	userID     string // who made the change
+	action     string // AuditCreate, AuditEdit, AuditCancel, AuditRestore, AuditRSVP or AuditCohost
+	field      string // the column that was edited
+	oldValue   string
+	newValue   string
+	changedAt  time.Time
+}
+
+// The text an audited value is stored as, whatever the column's type
+func auditValue(value interface{}) string {
+	return fmt.Sprint(value)
+}
+
+// Record a change to an Event in its history in the DB, as part of the transaction making the change
+func (store *SQLEventStore) audit(tx *sql.Tx, entry *AuditEntry) error {
+	_, err := tx.Exec(store.rebind(
+		`INSERT INTO event_audit (event_id, occurrence, user_id, action, field, old_value, new_value, changed_at)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?)`),
+		entry.eventID, entry.occurrence, entry.userID, entry.action, entry.field, entry.oldValue, entry.newValue,
+		time.Now().Unix())
+	return err
+}
+
+// Record someone RSVPing to an Event, or changing their RSVP, in its history in the DB
+func (store *SQLEventStore) auditRSVP(tx *sql.Tx, eventID string, occurrence int64, userID string, oldStatus string,
+	newStatus string) error {
+	id, _ := strconv.ParseInt(eventID, 10, 64)
+	return store.audit(tx, &AuditEntry{eventID: id, occurrence: occurrence, userID: userID, action: AuditRSVP,
+		oldValue: oldStatus, newValue: newStatus})
+}
+
+// Get the most recent limit changes to an Event and its RSVPs from the DB, oldest first
+func (store *SQLEventStore) RetrieveHistory(eventID int64, limit int) ([]*AuditEntry, error) {
+	stmt, err := store.prepare(
+		`SELECT id, event_id, occurrence, user_id, action, field, old_value, new_value, changed_at FROM event_audit
+        WHERE event_id=? ORDER BY id DESC LIMIT ?`)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := stmt.Query(eventID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer result.Close()
+
+	var history []*AuditEntry
+	for result.Next() {
+		var entry AuditEntry
+		var changedAt int64
+		err = result.Scan(&entry.id, &entry.eventID, &entry.occurrence, &entry.userID, &entry.action, &entry.field,
+			&entry.oldValue, &entry.newValue, &changedAt)
+		if err != nil {
+			return nil, err
+		}
+		entry.changedAt = time.Unix(changedAt, 0).UTC()
+		history = append([]*AuditEntry{&entry}, history...)
+	}
+	return history, result.Err()
+}
+
+// Show who created, changed, cancelled and RSVPed to an Event, most recent last
+func historyCommand(ctx *CommandContext, eventSearch string) {
+	event := findOneEvent(ctx, eventSearch, "Select one by its ID with !event history <ID>.")
+	if event == nil {
+		return
+	}
+
+	history, err := eventStore.RetrieveHistory(event.id, historyLimit)
+	if err != nil {
+		ctx.reply(err.Error())
+		return
+	}
+	if len(history) == 0 {
+		ctx.reply("No changes to **" + event.name + "** have been recorded.")
+		return
+	}
+
+	// Everyone who RSVPed or made a change is mentioned, and looking at the history shouldn't ping them all
+	ctx.replyQuietly(historyMessage(event, history))
+}
+
+// The reply to !event history, with as many of the most recent changes as fit in one message
+func historyMessage(event *Event, history []*AuditEntry) string {
+	header := "__**History of " + event.name + "**__\n"
+	length := len([]rune(header))
+
+	// Work back from the most recent change until the message is full
+	var lines []string
+	for i := len(history) - 1; i >= 0; i-- {
+		line := describeAuditEntry(event, history[i]) + "\n"
+		if length+len([]rune(line)) > historyMessageLength {
+			break
+		}
+		length += len([]rune(line))
+		lines = append([]string{line}, lines...)
+	}
+
+	var buffer bytes.Buffer
+	buffer.WriteString(header)
+	if hidden := len(history) - len(lines); len(history) == historyLimit {
+		buffer.WriteString("*Older changes not shown.*\n")
+	} else if hidden > 0 {
+		buffer.WriteString("*" + strconv.Itoa(hidden) + " older changes not shown.*\n")
+	}
+	for _, line := range lines {
+		buffer.WriteString(line)
+	}
+	return buffer.String()
+}
+
+// One line of !event history: when the change was made, then e.g. "<@1> changed the location from Park to Pub"
+func describeAuditEntry(event *Event, entry *AuditEntry) string {
+	loc := LoadTimezone(event.timezone)
+	line := "`" + entry.changedAt.In(loc).Format("Jan 2 3:04 PM") + "` <@" + entry.userID + "> "
+
+	of := ""
+	if entry.occurrence != 0 {
+		of = " of the " + time.Unix(entry.occurrence, 0).In(loc).Format("Jan 2") + " occurrence"
+	}
+
+	switch entry.action {
+	case AuditCreate:
+		return line + "created the event"
+	case AuditCancel:
+		if entry.occurrence != 0 {
+			return line + "cancelled the " + time.Unix(entry.occurrence, 0).In(loc).Format("Jan 2") + " occurrence"
+		}
+		if entry.newValue != "" {
+			return line + "cancelled the event (" + truncateAuditValue(entry.newValue) + ")"
+		}
+		return line + "cancelled the event"
+	case AuditRestore:
+		return line + "restored the event"
+	case AuditCohost:
+		if entry.newValue != "" {
+			return line + "made <@" + entry.newValue + "> a co-host"
+		}
+		return line + "removed <@" + entry.oldValue + "> as a co-host"
+	case AuditRSVP:
+		if entry.oldValue == "" {
+			return line + "RSVPed " + entry.newValue
+		}
+		if entry.oldValue == "Waitlisted" && entry.newValue == "Going" {
+			// Only the bot moves people off the waitlist, when a spot opens up
+			return line + "got a spot off the waitlist"
+		}
+		return line + "changed their RSVP from " + entry.oldValue + " to " + entry.newValue
+	}
+
+	field, ok := auditFieldNames[entry.field]
+	if !ok {
+		field = entry.field
+	}
+	return line + "changed the " + field + of + " from " + displayAuditValue(entry.field, entry.oldValue, loc) +
+		" to " + displayAuditValue(entry.field, entry.newValue, loc)
+}
+
+// Turn a stored value back into what people typed or were shown for it
+func displayAuditValue(field string, value string, loc *time.Location) string {
+	switch field {
+	case "starts_at":
+		unix, err := strconv.ParseInt(value, 10, 64)
+		if err == nil {
+			return time.Unix(unix, 0).In(loc).Format(historyTimeLayout)
+		}
+	case "creator_id":
+		return "<@" + value + ">"
+	case "max_attendees":
+		if value == "0" {
+			return "no limit"
+		}
+	case "recurrence":
+		if value == "" {
+			return "never"
+		}
+		rule, err := ParseRRule(value, loc)
+		if err == nil {
+			return rule.Describe(loc)
+		}
+	}
+	if value == "" {
+		return "nothing"
+	}
+	return truncateAuditValue(value)
+}
+
+// Shorten a long value, like a description, so a page of history fits in one message
+func truncateAuditValue(value string) string {
+	runes := []rune(value)
+	if len(runes) > historyValueLength {
+		return string(runes[:historyValueLength-3]) + "..."
+	}
+	return value
+}
@@ -2,19 +2,14 @@ package main
 
 import (
 	"bufio"
-	"encoding/json"
 	"flag"
 	"fmt"
-	"io/ioutil"
-	"net/http"
-	"net/url"
 	"os"
 	"os/signal"
 	"strings"
+	"time"
 
 	"github.com/bwmarrin/discordgo"
-
-	"regexp"
 )
 
 var (
@@ -22,68 +17,40 @@ var (
 
 	OWNER_ID           string
 	GENERAL_CHANNEL_ID string = "162620290487025674"
-
-	banned map[string]bool = make(map[string]bool)
 )
 
 func HandleOnReady(s *discordgo.Session, ready *discordgo.Ready) {
-	s.UpdateStatus(0, "")
+	s.UpdateGameStatus(0, "")
 }
 
 func HandleMessageCreate(s *discordgo.Session, msg *discordgo.MessageCreate) {
-	isInstagramLink, _ := regexp.MatchString("https?://w{0,3}\\.?instagram\\.com/p/", msg.Content)
-	if isInstagramLink {
-		go FixInstagramLink(s, msg)
+	if msg.GuildID == "" {
+		// Only messages in a guild are handled.  Events and reposts belong to one, and a DM would otherwise see the
+		// ones from before they were scoped to guilds.
+		return
+	}
+
+	if strings.Contains(msg.Content, "http") {
+		go FixEmbeds(s, msg)
 	}
 
 	if strings.HasPrefix(msg.Content, "!ev") || strings.HasPrefix(msg.Content, "!event") {
 		go HandleCommandInput(s, msg)
 	}
 
-
-	if strings.Compare(msg.Content, "I am a filthy reposter.") == 0 {
-		banned[msg.Author.ID] = false
-	}
-	if isBanned, _ := banned[msg.Author.ID]; isBanned {
-		s.ChannelMessageDelete(msg.ChannelID, msg.ID)
-	}
-	if strings.HasPrefix(msg.Content, "http") {
-		isRepost, _ := DetectRepost(msg.Content)
-		if isRepost {
-			s.ChannelMessageSend(msg.ChannelID, "Repost. You have been banned from posting until you say `I am a filthy reposter.`")
-			banned[msg.Author.ID] = true
-		}
+	if strings.HasPrefix(msg.Content, "!repost") {
+		go HandleRepostCommand(s, msg)
 	}
 
-	RecordMessage(msg.Author.ID, msg.Content)
+	CheckForReposts(s, msg)
 }
 
-func FixInstagramLink(s *discordgo.Session, msg *discordgo.MessageCreate) {
-	resp, err := http.PostForm("http://www.igeturl.com/get.php", url.Values{"url": {msg.Content}})
-
-	if err != nil {
-		fmt.Println("Error getting converted link")
-		return
-	}
-	defer resp.Body.Close()
-
-	body, err1 := ioutil.ReadAll(resp.Body)
-
-	if err1 != nil {
-		fmt.Println("Error reading response body")
-		return
-	}
-
-	var respMap map[string]*json.RawMessage
-	json.Unmarshal([]byte(body), &respMap)
+func HandleMessageReactionAdd(s *discordgo.Session, reaction *discordgo.MessageReactionAdd) {
+	go HandleAnnouncementReaction(s, reaction.MessageReaction, true)
+}
 
-	if string(*respMap["success"]) == "true" {
-		s.ChannelMessageSend(msg.ChannelID, "Let me fix that for you: ")
-		fixedUrl := string(*respMap["message"])
-		fixedUrl = strings.Replace(fixedUrl, "\\", "", -1)
-		fixedUrl = strings.Replace(fixedUrl, "\"", "", -1)
-		s.ChannelMessageSend(msg.ChannelID, fixedUrl)
-	}
+func HandleMessageReactionRemove(s *discordgo.Session, reaction *discordgo.MessageReactionRemove) {
+	go HandleAnnouncementReaction(s, reaction.MessageReaction, false)
 }
 
 func acceptStdIn() {
@@ -114,9 +81,23 @@ func parseCommand(input string) {
 
 func main() {
 	var (
-		Token = flag.String("t", "", "Discord Auth Token")
-		Owner = flag.String("o", "", "Bot Owner ID")
-		err   error
+		Token     = flag.String("t", "", "Discord Auth Token")
+		Owner     = flag.String("o", "", "Bot Owner ID")
+		Timezone  = flag.String("tz", DEFAULT_TIMEZONE, "Default timezone for events, e.g. America/New_York")
+		Reminders = flag.String("reminders", "24h,1h", "How long before an event to remind RSVPs, comma separated")
+		Distance  = flag.Int("image-distance", IMAGE_REPOST_DISTANCE, "Bits an image can differ by to be a repost, -1 is off")
+		Penalty   = flag.Duration("penalty", REPOST_PENALTY, "How long someone who reposts can't post for, 0 is off")
+		Unlock    = flag.String("unlock-phrase", UNLOCK_PHRASE, "What lifts a repost penalty early, empty to disable")
+		Rules     = flag.String("embed-rules", "", "JSON file of rules for fixing link embeds, default is the built-in rules")
+		Calendar  = flag.String("calendar", "", "Address to serve iCalendar feeds of events on, e.g. :8080")
+		FeedURL   = flag.String("calendar-url", "", "Public URL of the calendar feeds, default http://<calendar address>")
+		Legacy    = flag.String("legacy-guild", "", "Guild to move events and messages without a guild into")
+		Storage   = flag.String("db", "sqlite", "Where to store events and messages: sqlite, postgres or memory")
+		EventsDB  = flag.String("events-db", "./db/events.sqlite",
+			"SQLite file, or PostgreSQL connection string, of the events database")
+		MessagesDB = flag.String("messages-db", "./db/messages.sqlite",
+			"SQLite file, or PostgreSQL connection string, of the messages database")
+		err error
 	)
 	flag.Parse()
 
@@ -131,6 +112,58 @@ func main() {
 
 	OWNER_ID = *Owner
 
+	if _, err = time.LoadLocation(*Timezone); err != nil {
+		fmt.Println("Unknown timezone " + *Timezone)
+		return
+	}
+	DEFAULT_TIMEZONE = *Timezone
+	IMAGE_REPOST_DISTANCE = *Distance
+	REPOST_PENALTY = *Penalty
+	UNLOCK_PHRASE = *Unlock
+
+	if *Calendar != "" {
+		CALENDAR_URL = *FeedURL
+		if CALENDAR_URL == "" {
+			CALENDAR_URL = "http://" + *Calendar
+			if strings.HasPrefix(*Calendar, ":") {
+				CALENDAR_URL = "http://localhost" + *Calendar
+			}
+		}
+	}
+
+	err = LoadEmbedRules(*Rules)
+	if err != nil {
+		fmt.Println("Error loading embed rules: " + err.Error())
+		return
+	}
+
+	REMINDER_OFFSETS, err = ParseReminderOffsets(*Reminders)
+	if err != nil {
+		fmt.Println("Invalid reminder offsets " + *Reminders)
+		return
+	}
+
+	err = OpenStores(*Storage, *EventsDB, *MessagesDB)
+	if err != nil {
+		fmt.Println("Error opening storage: " + err.Error())
+		return
+	}
+
+	if *Legacy != "" {
+		// Databases from before events and messages were scoped to guilds belonged to a single server
+		events, err := eventStore.AssignUnscopedEvents(*Legacy)
+		if err != nil {
+			fmt.Println("Error assigning events to guild " + *Legacy + ": " + err.Error())
+			return
+		}
+		messages, err := messageStore.AssignUnscopedMessages(*Legacy)
+		if err != nil {
+			fmt.Println("Error assigning messages to guild " + *Legacy + ": " + err.Error())
+			return
+		}
+		fmt.Printf("Assigned %d events and %d messages to guild %s\n", events, messages, *Legacy)
+	}
+
 	fmt.Println("Creating Discord session")
 
 	session, err = discordgo.New(*Token)
@@ -142,11 +175,29 @@ func main() {
 
 	session.AddHandler(HandleOnReady)
 	session.AddHandler(HandleMessageCreate)
+	session.AddHandler(HandleMessageReactionAdd)
+	session.AddHandler(HandleMessageReactionRemove)
+	session.AddHandler(HandleInteractionCreate)
+
+	// Prefix commands need to read message content, which Discord only sends to bots that ask for it
+	session.Identify.Intents = discordgo.IntentsGuilds | discordgo.IntentsGuildMessages |
+		discordgo.IntentsGuildMessageReactions | discordgo.IntentsDirectMessages | discordgo.IntentsMessageContent
 
 	session.Open()
 
+	err = RegisterSlashCommands(session)
+	if err != nil {
+		fmt.Println("Error registering slash commands: " + err.Error())
+	}
+
 	fmt.Println("Session initialization finished")
 
+	go RunReminderScheduler(session)
+
+	if *Calendar != "" {
+		go ServeCalendarFeed(session, *Calendar)
+	}
+
 	go acceptStdIn()
 
 	quit := make(chan os.Signal, 1)
@@ -2,11 +2,88 @@ package main
 
 import (
 	"database/sql"
+	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 )
 
-func OpenDB( dbPath string ) *sql.DB {
-	db, err := sql.Open("sqlite3", dbPath)
-	PanicIf( err )
-	return db;
-}
\ No newline at end of file
+// A database the bot stores things in through database/sql, along with the driver it was opened with
+// Queries are written with ? placeholders and rewritten for drivers that number them instead
+type sqlDB struct {
+	db     *sql.DB
+	driver string // sqlite3 or postgres
+}
+
+// Open one of the bot's databases, creating it if needed and migrating it to the latest schema
+// For SQLite dataSource is the path to the database file, for PostgreSQL it is a connection string
+func OpenDB(driver string, dataSource string, dbName string) (*sqlDB, error) {
+	if driver == "sqlite3" {
+		err := os.MkdirAll(filepath.Dir(dataSource), 0755)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	db, err := sql.Open(driver, dataSource)
+	if err != nil {
+		return nil, err
+	}
+
+	store := &sqlDB{db: db, driver: driver}
+	err = store.migrate(dbName)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+// Rewrite a query's ? placeholders as $1, $2, ... for PostgreSQL
+func (store *sqlDB) rebind(query string) string {
+	if store.driver != "postgres" {
+		return query
+	}
+
+	var builder strings.Builder
+	n := 0
+	for _, c := range query {
+		if c == '?' {
+			n++
+			builder.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		builder.WriteRune(c)
+	}
+	return builder.String()
+}
+
+func (store *sqlDB) prepare(query string) (*sql.Stmt, error) {
+	return store.db.Prepare(store.rebind(query))
+}
+
+// Prepare an INSERT whose new row's ID will be read with insert
+func (store *sqlDB) prepareInsert(query string) (*sql.Stmt, error) {
+	if store.driver == "postgres" {
+		// PostgreSQL doesn't report the last inserted ID, it has to be asked for
+		query += ` RETURNING id`
+	}
+	return store.prepare(query)
+}
+
+// Run an INSERT prepared with prepareInsert in a transaction and return the new row's ID
+func (store *sqlDB) insert(tx *sql.Tx, stmt *sql.Stmt, args ...interface{}) (int64, error) {
+	if store.driver == "postgres" {
+		var id int64
+		err := tx.Stmt(stmt).QueryRow(args...).Scan(&id)
+		return id, err
+	}
+
+	result, err := tx.Stmt(stmt).Exec(args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
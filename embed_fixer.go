@@ -0,0 +1,140 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+var (
+	// Everything that can rewrite a link Discord can't embed, tried in order
+	EMBED_FIXERS []EmbedFixer
+
+	// Whether to hide the embeds of a message whose links were fixed, so only the fixed ones show
+	SUPPRESS_FIXED_EMBEDS bool
+)
+
+//go:embed embed_rules.json
+var defaultEmbedRules []byte
+
+// An EmbedFixer rewrites links to a site Discord can't embed properly into links to a mirror that it can
+type EmbedFixer interface {
+	// Rewrite a link, or return false if it isn't one this fixer handles
+	FixLink(link *url.URL) (string, bool)
+}
+
+// A RewriteRule moves links matching a pattern to a mirror host that serves the same paths
+type RewriteRule struct {
+	name    string
+	pattern *regexp.Regexp // matched against the link's lowercased host and its path, e.g. "x.com/user/status/1"
+	host    string
+}
+
+// Rewrite a link matching the rule's pattern to the rule's host, dropping its query, which on these sites only
+// tracks who shared it
+func (rule *RewriteRule) FixLink(link *url.URL) (string, bool) {
+	if !rule.pattern.MatchString(strings.ToLower(link.Hostname()) + link.EscapedPath()) {
+		return "", false
+	}
+	return "https://" + rule.host + link.EscapedPath(), true
+}
+
+// The file rewrite rules are configured in
+type embedRulesFile struct {
+	SuppressEmbeds bool `json:"suppress_embeds"`
+	Rules          []struct {
+		Name    string `json:"name"`
+		Pattern string `json:"pattern"`
+		Host    string `json:"host"`
+	} `json:"rules"`
+}
+
+// Set up EMBED_FIXERS and SUPPRESS_FIXED_EMBEDS from a JSON file of rewrite rules, or the built-in rules if path is
+// empty
+func LoadEmbedRules(path string) error {
+	raw := defaultEmbedRules
+	if path != "" {
+		var err error
+		raw, err = ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+	}
+
+	var config embedRulesFile
+	err := json.Unmarshal(raw, &config)
+	if err != nil {
+		return err
+	}
+
+	var fixers []EmbedFixer
+	for _, rule := range config.Rules {
+		if rule.Pattern == "" || rule.Host == "" {
+			return errors.New("rule " + rule.Name + " needs a pattern and a host")
+		}
+		pattern, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return fmt.Errorf("rule %s: %v", rule.Name, err)
+		}
+		fixers = append(fixers, &RewriteRule{rule.Name, pattern, rule.Host})
+	}
+
+	EMBED_FIXERS = fixers
+	SUPPRESS_FIXED_EMBEDS = config.SuppressEmbeds
+	return nil
+}
+
+// Rewrite the links in a message that Discord can't embed, each only once
+func FixLinks(message string) []string {
+	var fixed []string
+	seen := make(map[string]bool)
+	for _, raw := range urlPattern.FindAllString(message, -1) {
+		link, err := url.Parse(trimLinkEnd(raw))
+		if err != nil {
+			continue
+		}
+		for _, fixer := range EMBED_FIXERS {
+			fixedLink, ok := fixer.FixLink(link)
+			if ok {
+				if !seen[fixedLink] {
+					fixed = append(fixed, fixedLink)
+					seen[fixedLink] = true
+				}
+				break
+			}
+		}
+	}
+	return fixed
+}
+
+// Reply to a message with links Discord can embed in place of any it can't, all in one message, and hide the
+// original message's broken embeds if configured to
+func FixEmbeds(s *discordgo.Session, msg *discordgo.MessageCreate) {
+	if msg.Author.Bot {
+		return
+	}
+
+	fixed := FixLinks(msg.Content)
+	if len(fixed) == 0 {
+		return
+	}
+	s.ChannelMessageSend(msg.ChannelID, "Let me fix that for you:\n"+strings.Join(fixed, "\n"))
+
+	if SUPPRESS_FIXED_EMBEDS {
+		// Only the flags of someone else's message can be edited, so send nothing else
+		endpoint := discordgo.EndpointChannelMessage(msg.ChannelID, msg.ID)
+		_, err := s.RequestWithBucketID("PATCH", endpoint,
+			map[string]interface{}{"flags": msg.Flags | discordgo.MessageFlagsSuppressEmbeds},
+			discordgo.EndpointChannelMessage(msg.ChannelID, ""))
+		if err != nil {
+			fmt.Println("Error suppressing embeds: " + err.Error())
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFixLinks(t *testing.T) {
+	err := LoadEmbedRules("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		message string
+		want    []string
+	}{
+		{"No links here", nil},
+		{"https://www.instagram.com/p/abc123/?igsh=share", []string{"https://ddinstagram.com/p/abc123/"}},
+		{"Look! https://m.instagram.com/reel/xyz.", []string{"https://ddinstagram.com/reel/xyz"}},
+		{"https://INSTAGRAM.com/p/abc123 and https://instagram.com/p/abc123",
+			[]string{"https://ddinstagram.com/p/abc123"}},
+		// Profiles embed fine, and lookalike hosts aren't Instagram
+		{"https://www.instagram.com/someone", nil},
+		{"https://notinstagram.com/p/abc123 https://instagram.com.example.com/p/abc123", nil},
+		{"https://example.com/p/abc123", nil},
+	}
+
+	for _, c := range cases {
+		got := FixLinks(c.message)
+		if strings.Join(got, " ") != strings.Join(c.want, " ") {
+			t.Fatalf("%q: got %q, want %q", c.message, got, c.want)
+		}
+	}
+}
+
+func TestDefaultEmbedRules(t *testing.T) {
+	err := LoadEmbedRules("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		link string
+		want string // empty if the link embeds fine already
+	}{
+		{"https://x.com/someone/status/123?s=20", "https://fxtwitter.com/someone/status/123"},
+		{"https://mobile.twitter.com/someone/status/123", "https://fxtwitter.com/someone/status/123"},
+		{"https://x.com/someone", ""},
+		{"https://www.tiktok.com/@someone/video/123", "https://vxtiktok.com/@someone/video/123"},
+		{"https://old.reddit.com/r/golang/comments/abc/title/", "https://rxddit.com/r/golang/comments/abc/title/"},
+		{"https://www.reddit.com/r/golang/s/abc", "https://rxddit.com/r/golang/s/abc"},
+		{"https://www.reddit.com/r/golang/", ""},
+		{"https://bsky.app/profile/someone.bsky.social/post/abc",
+			"https://bskx.app/profile/someone.bsky.social/post/abc"},
+		{"https://www.pixiv.net/en/artworks/123", "https://phixiv.net/en/artworks/123"},
+	}
+
+	for _, c := range cases {
+		got := strings.Join(FixLinks(c.link), " ")
+		if got != c.want {
+			t.Fatalf("%q: got %q, want %q", c.link, got, c.want)
+		}
+	}
+}
+
+func TestLoadEmbedRules(t *testing.T) {
+	cases := []struct {
+		name         string
+		config       string
+		wantErr      bool
+		wantSuppress bool
+		message      string
+		want         string // the message's fixed links
+	}{
+		{"custom rule", `{"suppress_embeds": true, "rules": [{"name": "Example", "pattern": "^example\\.com/post/",
+            "host": "fixed.example"}]}`, false, true, "https://example.com/post/1 https://x.com/a/status/1",
+			"https://fixed.example/post/1"},
+		// Earlier rules win when more than one matches
+		{"rule order", `{"rules": [{"name": "A", "pattern": "^example\\.com/", "host": "a.example"},
+            {"name": "B", "pattern": "^example\\.com/post/", "host": "b.example"}]}`, false, false,
+			"https://example.com/post/1", "https://a.example/post/1"},
+		{"no rules", `{"rules": []}`, false, false, "https://x.com/a/status/1", ""},
+		{"not JSON", `rules:`, true, false, "", ""},
+		{"missing host", `{"rules": [{"name": "Example", "pattern": "^example\\.com/"}]}`, true, false, "", ""},
+		{"bad pattern", `{"rules": [{"name": "Example", "pattern": "^(example", "host": "fixed.example"}]}`, true,
+			false, "", ""},
+	}
+	defer LoadEmbedRules("")
+
+	for _, c := range cases {
+		path := filepath.Join(t.TempDir(), "embed_rules.json")
+		err := ioutil.WriteFile(path, []byte(c.config), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = LoadEmbedRules(path)
+		if (err != nil) != c.wantErr {
+			t.Fatalf("%s: got error %v, want error %v", c.name, err, c.wantErr)
+		}
+		if err != nil {
+			continue
+		}
+		if SUPPRESS_FIXED_EMBEDS != c.wantSuppress {
+			t.Fatalf("%s: got suppress_embeds %v, want %v", c.name, SUPPRESS_FIXED_EMBEDS, c.wantSuppress)
+		}
+		if got := strings.Join(FixLinks(c.message), " "); got != c.want {
+			t.Fatalf("%s: got %q, want %q", c.name, got, c.want)
+		}
+	}
+
+	if err := LoadEmbedRules(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Fatal("loaded rules from a file that doesn't exist")
+	}
+}
@@ -0,0 +1,898 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// A CommandContext is where an event planner command came from and how to answer it, so that prefix commands and
+// slash commands share one implementation
+type CommandContext struct {
+	session   *discordgo.Session
+	guildID   string
+	channelID string
+	user      *discordgo.User
+	member    *discordgo.Member // the user's roles in the guild, or nil outside of one
+
+	// Answer the command.  Prefix commands are answered in the channel, slash commands only to the user who ran them.
+	reply func(content string)
+	// Answer the command without pinging the users it mentions, for answers that list other people
+	replyQuietly func(content string)
+	// Tell the user who ran the command something only they should see
+	private func(content string)
+	// Answer the command with a file
+	replyFile func(name string, content io.Reader)
+}
+
+// Build the CommandContext for a prefix command sent as a message
+func NewMessageContext(s *discordgo.Session, msg *discordgo.MessageCreate) *CommandContext {
+	return &CommandContext{
+		session:   s,
+		guildID:   msg.GuildID,
+		channelID: msg.ChannelID,
+		user:      msg.Author,
+		member:    msg.Member,
+		reply: func(content string) {
+			s.ChannelMessageSend(msg.ChannelID, content)
+		},
+		replyQuietly: func(content string) {
+			s.ChannelMessageSendComplex(msg.ChannelID, &discordgo.MessageSend{
+				Content:         content,
+				AllowedMentions: &discordgo.MessageAllowedMentions{},
+			})
+		},
+		private: func(content string) {
+			channel, channelErr := s.UserChannelCreate(msg.Author.ID)
+			PanicIf(channelErr)
+			s.ChannelMessageSend(channel.ID, content)
+		},
+		replyFile: func(name string, content io.Reader) {
+			s.ChannelFileSend(msg.ChannelID, name, content)
+		},
+	}
+}
+
+// List the Events a search matched so the user can pick one by its ID and retry their command
+func replyMatches(ctx *CommandContext, events []*Event, retry string) {
+	var buffer bytes.Buffer
+	for _, event := range events {
+		buffer.WriteString(
+			"ID: " + strconv.FormatInt(event.id, 10) + " `**" + event.name + "** on " + event.When() + "`\n")
+	}
+	ctx.reply("Your query matched the following events:\n" + buffer.String() + retry)
+}
+
+// Create an Event from the fields typed by a user and announce it
+func createEventCommand(ctx *CommandContext, name, description, location, date, clock, max string) {
+	var maxAttendees int64
+	if max != "" {
+		var err error
+		maxAttendees, err = parseMaxAttendees(max)
+		if err != nil {
+			ctx.reply(err.Error())
+			return
+		}
+	}
+
+	loc, err := RetrieveGuildTimezone(ctx.guildID)
+	if err != nil {
+		ctx.reply(err.Error())
+		return
+	}
+	startsAt, err := ParseEventDateTime(date+" "+clock, loc, time.Now())
+	if err != nil {
+		ctx.reply(err.Error())
+		return
+	}
+
+	event, err := eventStore.CreateEvent(
+		ctx.guildID,
+		name,
+		description,
+		location,
+		startsAt,
+		loc.String(),
+		maxAttendees,
+		ctx.user.Username,
+		ctx.user.ID)
+
+	if err == nil {
+		err = ScheduleReminders(event)
+	}
+
+	// Let the creator know the details of the created Event
+	if err != nil {
+		ctx.private("Event creation failed.  Please make sure you are using the command correctly.")
+		return
+	}
+	ctx.private(
+		"**Created event:** " + name + "\n" +
+			"**Description:** " + description + "\n" +
+			"**When:** " + event.When() + "\n" +
+			"**Where:** " + location + "\n" +
+			event.capacityLine() +
+			"Your event ID is " + strconv.FormatInt(event.id, 10) + ".\n" +
+			"Remember this ID if you wish to make changes to your event.")
+
+	if err := AnnounceEvent(ctx.session, ctx.guildID, event); err != nil {
+		ctx.reply("The event was created but couldn't be announced: " + err.Error())
+	}
+}
+
+// Show an Event, or one occurrence of a recurring Event, with its RSVPs
+func infoCommand(ctx *CommandContext, eventSearch, occurrenceDate string) {
+	events, err := RetrieveEvent(ctx.guildID, eventSearch)
+	if err != nil {
+		ctx.reply(err.Error())
+		return
+	}
+
+	if len(events) > 1 {
+		replyMatches(ctx, events, "Select one by its ID with !event info <ID> for more information.")
+
+	} else if len(events) == 1 {
+		// Recurring Events show their next occurrence unless a date was given
+		event, err := selectOccurrence(events[0], occurrenceDate, time.Now())
+		if err != nil {
+			ctx.reply(err.Error())
+			return
+		}
+		// Retrieve the RSVPs for this Event to display with the Event information
+		rsvps, err := eventStore.RetrieveRSVPs(strconv.FormatInt(event.id, 10), event.occurrence)
+		if err != nil {
+			ctx.reply(err.Error())
+			return
+		}
+		var buffer bytes.Buffer
+		for i, rsvp := range rsvps {
+			buffer.WriteString("__" + rsvp.username + "__: " + rsvp.status)
+			if i < (len(rsvps) - 1) {
+				buffer.WriteString("    ")
+			}
+		}
+		ctx.reply(event.String() + cohostLine(event) + event.upcomingLine(time.Now()) + "\n" + buffer.String())
+	} else {
+		ctx.reply("No events found.  Try a different search.")
+	}
+}
+
+// Cancel an Event, or one occurrence of a recurring Event, and let the people going to it know, along with the reason
+// if one was given
+func cancelCommand(ctx *CommandContext, eventSearch, occurrenceDate, reason string) {
+	s := ctx.session
+	events, err := RetrieveEvent(ctx.guildID, eventSearch)
+	if err != nil {
+		ctx.reply(err.Error())
+		return
+	}
+
+	if len(events) > 1 {
+		replyMatches(ctx, events, "Select one by its ID with !event info <ID> for more information.")
+
+	} else if len(events) == 1 {
+		// Cancel the event
+		event := events[0]
+		if !CanManageEvent(ctx, event) {
+			ctx.reply("You can't cancel an event you didn't create or co-host.")
+			return
+		}
+		if event.status == EventCancelled {
+			ctx.reply("**" + event.name + "** has already been cancelled.")
+			return
+		}
+		idStr := strconv.FormatInt(event.id, 10)
+		reason = strings.TrimSpace(reason)
+		because := ""
+		if reason != "" {
+			because = "Reason: " + reason + "\n"
+		}
+
+		if occurrenceDate != "" {
+			// Cancel just one occurrence of a recurring Event
+			occurrence, err := FindOccurrence(event, occurrenceDate, time.Now())
+			if err != nil {
+				ctx.reply(err.Error())
+				return
+			}
+			err = CancelOccurrence(event.id, occurrence.occurrence, ctx.user.ID)
+			if err == nil {
+				err = ScheduleReminders(event)
+			}
+			if err != nil {
+				ctx.reply(err.Error())
+				return
+			}
+			ctx.reply("Event on " + occurrence.When() + " cancelled.")
+			RefreshAnnouncement(s, idStr)
+
+			rsvps, err := eventStore.RetrieveRSVPs(idStr, occurrence.occurrence)
+			if err != nil {
+				ctx.reply(err.Error())
+				return
+			}
+			notifyRSVPs(s, rsvps, "**"+event.name+"** on "+occurrence.When()+" has been cancelled.\n"+because)
+			return
+		}
+
+		// Retrieve the RSVPs before cancelling because we want to let them know afterwards
+		rsvps, err := eventStore.RetrieveAllRSVPs(idStr)
+		if err != nil {
+			ctx.reply(err.Error())
+			return
+		}
+		err = eventStore.CancelEvent(idStr, reason, time.Now(), ctx.user.ID)
+		if err != nil {
+			ctx.reply(err.Error())
+			return
+		}
+		ctx.reply("Event cancelled.  Undo it with !event restore " + idStr)
+		CloseAnnouncement(s, event)
+
+		// Let everyone who is or might be going to this Event know that it has been cancelled
+		notifyRSVPs(s, rsvps, "**"+event.name+"** has been cancelled.\n"+because)
+	} else {
+		ctx.reply("No events found.  Try a different search.")
+	}
+}
+
+// Put a cancelled Event back on the schedule and let the people who were going to it know it is on again
+func restoreCommand(ctx *CommandContext, eventSearch string) {
+	s := ctx.session
+	events, err := RetrieveEvent(ctx.guildID, eventSearch)
+	if err != nil {
+		ctx.reply(err.Error())
+		return
+	}
+	if len(events) != 1 {
+		ctx.reply("No cancelled event has that ID.  Cancelled events can only be restored by their ID.")
+		return
+	}
+
+	event := events[0]
+	if !CanManageEvent(ctx, event) {
+		ctx.reply("You can't restore an event you didn't create or co-host.")
+		return
+	}
+	if event.status != EventCancelled {
+		ctx.reply("**" + event.name + "** isn't cancelled.")
+		return
+	}
+
+	idStr := strconv.FormatInt(event.id, 10)
+	err = eventStore.RestoreEvent(idStr, ctx.user.ID)
+	if err != nil {
+		ctx.reply(err.Error())
+		return
+	}
+	event.status = EventScheduled
+	err = ScheduleReminders(event)
+	if err != nil {
+		ctx.reply(err.Error())
+		return
+	}
+	ctx.reply("**" + event.name + "** has been restored.")
+	ReopenAnnouncement(s, event)
+
+	rsvps, err := eventStore.RetrieveAllRSVPs(idStr)
+	if err != nil {
+		ctx.reply(err.Error())
+		return
+	}
+	notifyRSVPs(s, rsvps, "**"+event.name+"** is back on: "+event.When()+".\n")
+}
+
+// Change one or more fields of an Event, or of one occurrence of a recurring Event, all at once, and let the people
+// going to it know what changed in one message
+func editCommand(ctx *CommandContext, eventSearch, occurrenceDate string, edits []FieldEdit) {
+	s := ctx.session
+	events, err := RetrieveEvent(ctx.guildID, eventSearch)
+	if err != nil {
+		ctx.reply(err.Error())
+		return
+	}
+
+	if len(events) > 1 {
+		replyMatches(ctx, events, "Select one by its ID with !event info <ID> for more information.")
+
+	} else if len(events) == 1 {
+		// Update the Event with the new information
+		event := events[0]
+
+		if !CanManageEvent(ctx, event) {
+			ctx.reply("You can't edit an event you didn't create or co-host.")
+			return
+		}
+		if event.status == EventCancelled {
+			ctx.reply("**" + event.name + "** has been cancelled.  Restore it with !event restore " +
+				strconv.FormatInt(event.id, 10) + " first.")
+			return
+		}
+
+		// With a date, only that occurrence of a recurring Event is changed instead of the whole series
+		if occurrenceDate != "" {
+			event, err = FindOccurrence(event, occurrenceDate, time.Now())
+			if err != nil {
+				ctx.reply(err.Error())
+				return
+			}
+		}
+
+		idStr := strconv.FormatInt(event.id, 10)
+
+		var msgBuffer bytes.Buffer
+		if event.occurrence != 0 {
+			msgBuffer.WriteString("**" + event.name + "** on " + event.When() + " has been updated.\n")
+		} else {
+			msgBuffer.WriteString("**" + event.name + "** has been updated.\n")
+		}
+
+		// Work out every change before saving any, so a mistake in one of them doesn't leave the rest half done
+		wasRecurring := event.recurrence != nil
+		var changes []ColumnChange
+		changed := make(map[string]int)
+		for _, edit := range edits {
+			change, description, err := applyFieldEdit(event, edit, time.Now())
+			if err != nil {
+				ctx.reply(err.Error())
+				return
+			}
+			msgBuffer.WriteString(description + "\n")
+
+			// Changing the date and the time both move the start, which only needs saving once
+			if i, ok := changed[change.column]; ok {
+				changes[i] = change
+			} else {
+				changed[change.column] = len(changes)
+				changes = append(changes, change)
+			}
+		}
+
+		_, moved := changed["starts_at"]
+		_, repeated := changed["recurrence"]
+		if event.occurrence == 0 && ((wasRecurring && (moved || repeated)) || (!wasRecurring && repeated)) {
+			problem, err := occurrenceKeysInUse(event, wasRecurring)
+			if err != nil {
+				ctx.reply(err.Error())
+				return
+			}
+			if problem != "" {
+				ctx.reply(problem)
+				return
+			}
+		}
+		if moved && event.occurrence == 0 && event.status == EventCompleted && event.startsAt.After(time.Now()) {
+			// It had already happened, but now it hasn't
+			event.status = EventScheduled
+			changes = append(changes, ColumnChange{"status", EventScheduled})
+		}
+
+		if event.occurrence != 0 {
+			err = eventStore.UpdateOccurrenceColumns(event.id, event.occurrence, changes, ctx.user.ID)
+		} else {
+			err = eventStore.UpdateEventColumns(idStr, changes, ctx.user.ID)
+		}
+		if err == nil && (moved || repeated) {
+			err = ScheduleReminders(event)
+		}
+
+		// Let the creator/editor know the status of the update
+		if err != nil {
+			ctx.private("There was a problem updating " + event.name +
+				".  Please make sure you are using the command correctly.")
+			return
+		}
+		ctx.private(event.name + " updated successfully.")
+		RefreshAnnouncement(s, idStr)
+
+		// Let everyone who is or might be going to this Event (or occurrence) know it has been updated
+		var rsvps []*RSVP
+		if event.occurrence != 0 {
+			rsvps, err = eventStore.RetrieveRSVPs(idStr, event.occurrence)
+		} else {
+			rsvps, err = eventStore.RetrieveAllRSVPs(idStr)
+		}
+		if err != nil {
+			ctx.reply(err.Error())
+			return
+		}
+		notifyRSVPs(s, rsvps, msgBuffer.String())
+
+		// Raising the limit may have opened up spots for people on the waitlist of any occurrence
+		promotedOccurrences := make(map[int64]bool)
+		for _, rsvp := range rsvps {
+			if rsvp.status != "Waitlisted" || promotedOccurrences[rsvp.occurrence] {
+				continue
+			}
+			promotedOccurrences[rsvp.occurrence] = true
+
+			promoted, err := eventStore.PromoteWaitlist(idStr, rsvp.occurrence)
+			if err != nil {
+				ctx.reply(err.Error())
+				return
+			}
+			occurrence, err := RetrieveOccurrence(event.seriesEvent(), rsvp.occurrence)
+			if err == nil {
+				notifyPromoted(s, occurrence, promoted)
+			}
+		}
+		if len(promotedOccurrences) > 0 {
+			RefreshAnnouncement(s, idStr)
+		}
+
+	} else {
+		ctx.reply("No events found.  Try a different search.")
+	}
+}
+
+// What !event edit can change, for when it is asked to change something else
+const editableFields = "Editable fields are name, desc[ription], desc+ (to add to the description), loc[ation], " +
+	"date, time, max, and repeat."
+
+// RSVPs and changes to single occurrences of a recurring Event are kept by when each occurrence was first due to
+// start, so moving the series or changing how it repeats would lose track of them.  Explain why the series can't be
+// changed if there are any, or return an empty string if there aren't.
+func occurrenceKeysInUse(event *Event, wasRecurring bool) (string, error) {
+	rsvps, err := eventStore.RetrieveAllRSVPs(strconv.FormatInt(event.id, 10))
+	if err != nil {
+		return "", err
+	}
+	if !wasRecurring {
+		if len(rsvps) > 0 {
+			return "People have already RSVPed to **" + event.name + "**, and their RSVPs wouldn't carry over to " +
+				"the new dates.  Create a new repeating event instead.", nil
+		}
+		return "", nil
+	}
+
+	exceptions, err := eventStore.RetrieveEventExceptions(event.id)
+	if err != nil {
+		return "", err
+	}
+	inUse := len(exceptions) > 0
+	for _, rsvp := range rsvps {
+		inUse = inUse || rsvp.occurrence != 0
+	}
+	if inUse {
+		return "Some dates of **" + event.name + "** have been RSVPed to, moved or cancelled, and those are kept " +
+			"by their original dates, so the whole series can't be moved or repeat differently.  Change single " +
+			"dates with !event edit " + strconv.FormatInt(event.id, 10) + "@date|..., or create a new event.", nil
+	}
+	return "", nil
+}
+
+// A FieldEdit is one change asked for with !event edit, e.g. loc=The Pub
+type FieldEdit struct {
+	field string
+	value string
+}
+
+// Read the changes asked for with !event edit: any number of field=value pairs, or the older fieldName|newValue
+// Returns false if they are neither
+func ParseFieldEdits(parts []string) ([]FieldEdit, bool) {
+	if len(parts) == 2 && !strings.Contains(parts[0], "=") {
+		return []FieldEdit{{strings.TrimSpace(parts[0]), parts[1]}}, true
+	}
+
+	var edits []FieldEdit
+	for _, part := range parts {
+		// Only the first = separates the field from the value, which may contain more of them
+		pair := strings.SplitN(part, "=", 2)
+		if len(pair) != 2 || strings.TrimSpace(pair[0]) == "" {
+			return nil, false
+		}
+		edits = append(edits, FieldEdit{strings.TrimSpace(pair[0]), strings.TrimSpace(pair[1])})
+	}
+	return edits, len(edits) > 0
+}
+
+// Work out the column an edit changes and the value to save in it, and describe the change for the people going
+// The edit is applied to event too, so later edits to the same Event build on it, e.g. a date then a time.
+func applyFieldEdit(event *Event, edit FieldEdit, now time.Time) (ColumnChange, string, error) {
+	newValue := edit.value
+	switch strings.ToLower(edit.field) {
+	case "name", "title":
+		if event.occurrence != 0 {
+			return ColumnChange{}, "", errors.New("The name can only be changed for the whole series.")
+		}
+		if strings.TrimSpace(newValue) == "" {
+			return ColumnChange{}, "", errors.New("An event's name can't be empty.")
+		}
+		event.name = strings.TrimSpace(newValue)
+		return ColumnChange{"name", event.name}, "New name: " + event.name, nil
+	case "description", "desc":
+		event.description = newValue
+		return ColumnChange{"description", newValue}, "New description: " + newValue, nil
+	case "description+", "desc+": // for appending to the description instead of overwriting it
+		event.description += "\n*Update:* " + newValue
+		return ColumnChange{"description", event.description}, "Update: " + newValue, nil
+	case "location", "loc":
+		event.location = newValue
+		return ColumnChange{"location", newValue}, "New location: " + newValue, nil
+	case "date":
+		// Move the Event to the new day while keeping its time of day
+		local := event.LocalTime()
+		day, err := ParseEventDate(newValue, local.Location(), now)
+		if err != nil {
+			return ColumnChange{}, "", err
+		}
+		event.startsAt = time.Date(day.Year(), day.Month(), day.Day(), local.Hour(), local.Minute(), 0, 0,
+			local.Location()).UTC()
+		return ColumnChange{"starts_at", event.startsAt.Unix()}, "New date: " + event.When(), nil
+	case "time":
+		// Move the Event to the new time of day while keeping its day
+		local := event.LocalTime()
+		hour, minute, err := ParseEventClock(newValue)
+		if err != nil {
+			return ColumnChange{}, "", err
+		}
+		event.startsAt = time.Date(local.Year(), local.Month(), local.Day(), hour, minute, 0, 0,
+			local.Location()).UTC()
+		return ColumnChange{"starts_at", event.startsAt.Unix()}, "New time: " + event.When(), nil
+	case "max", "capacity":
+		if event.occurrence != 0 {
+			return ColumnChange{}, "", errors.New("The maximum attendees can only be changed for the whole series.")
+		}
+		maxAttendees, err := parseMaxAttendees(newValue)
+		if err != nil {
+			return ColumnChange{}, "", err
+		}
+		event.maxAttendees = maxAttendees
+		if maxAttendees == 0 {
+			return ColumnChange{"max_attendees", maxAttendees}, "There is no longer a limit on attendees.", nil
+		}
+		return ColumnChange{"max_attendees", maxAttendees},
+			"New maximum attendees: " + strconv.FormatInt(maxAttendees, 10), nil
+	case "repeat", "repeats", "recurrence":
+		if event.occurrence != 0 {
+			return ColumnChange{}, "", errors.New("How an event repeats can only be changed for the whole series.")
+		}
+		rule, err := ParseRecurrence(newValue, LoadTimezone(event.timezone), now)
+		if err != nil {
+			return ColumnChange{}, "", err
+		}
+		event.recurrence = rule
+		if rule == nil {
+			return ColumnChange{"recurrence", ""}, "It no longer repeats.", nil
+		}
+		return ColumnChange{"recurrence", rule.String()},
+			"Now repeats " + rule.Describe(LoadTimezone(event.timezone)), nil
+	}
+	return ColumnChange{}, "", errors.New(editableFields)
+}
+
+// RSVP the user to an Event, or to one occurrence of a recurring Event
+func rsvpCommand(ctx *CommandContext, eventSearch, occurrenceDate, choice string) {
+	s := ctx.session
+
+	// Validate RSVP choice
+	switch strings.ToLower(choice) {
+	case "g", "going":
+		choice = "Going"
+
+	case "m", "maybe":
+		choice = "Maybe"
+
+	case "n", "not going":
+		choice = "Not going"
+
+	default:
+		ctx.reply("Valid RSVP choices: G[oing], M[aybe], N[ot going]")
+		return
+	}
+
+	events, err := RetrieveEvent(ctx.guildID, eventSearch)
+	if err != nil {
+		ctx.reply(err.Error())
+		return
+	}
+
+	if len(events) > 1 {
+		replyMatches(ctx, events, "Select one by its ID with !event info <ID> for more information.")
+
+	} else if len(events) == 1 {
+		// RSVPs to a recurring Event are for its next occurrence unless a date was given
+		event, err := selectOccurrence(events[0], occurrenceDate, time.Now())
+		if err != nil {
+			ctx.reply(err.Error())
+			return
+		}
+		if event.status == EventCancelled {
+			ctx.reply("**" + event.name + "** has been cancelled.")
+			return
+		}
+
+		// Update the RSVP if it already exists, otherwise create one
+		idStr := strconv.FormatInt(event.id, 10)
+		rsvps, err := eventStore.RetrieveRSVPs(idStr, event.occurrence)
+		var rsvp *RSVP
+		for _, existing := range rsvps {
+			if existing.userID == ctx.user.ID {
+				rsvp, err = eventStore.UpdateRSVP(strconv.FormatInt(existing.id, 10), choice)
+				break
+			}
+		}
+		if rsvp == nil && err == nil {
+			rsvp, err = eventStore.CreateRSVP(idStr, event.occurrence, ctx.user.Username, ctx.user.ID, choice)
+		}
+
+		if err != nil {
+			ctx.reply("Submit RSVP failed.  Please make sure you are using the command correctly")
+			return
+		}
+		if rsvp.status == "Waitlisted" {
+			ctx.private(event.name + " is full, so you've been added to the waitlist.  " +
+				"You'll get a message if a spot opens up.")
+		} else {
+			ctx.private("RSVP submitted - " + event.name + " on " + event.When() + ": " + rsvp.status)
+		}
+
+		// Someone who was going may have given up their spot
+		promoted, err := eventStore.PromoteWaitlist(idStr, event.occurrence)
+		if err != nil {
+			ctx.reply(err.Error())
+			return
+		}
+		notifyPromoted(s, event, promoted)
+		RefreshAnnouncement(s, idStr)
+
+	} else {
+		ctx.reply("No events found.  Try a different search.")
+	}
+}
+
+// Upload an Event as an iCalendar file
+func icsCommand(ctx *CommandContext, eventSearch string) {
+	events, err := RetrieveEvent(ctx.guildID, eventSearch)
+	if err != nil {
+		ctx.reply(err.Error())
+		return
+	}
+
+	if len(events) > 1 {
+		replyMatches(ctx, events, "Select one by its ID with !event ics <ID> to download it.")
+
+	} else if len(events) == 1 {
+		calendar, err := EventICS(events[0], time.Now())
+		if err != nil {
+			ctx.reply(err.Error())
+			return
+		}
+		ctx.replyFile("event-"+strconv.FormatInt(events[0].id, 10)+".ics", strings.NewReader(calendar))
+	} else {
+		ctx.reply("No events found.  Try a different search.")
+	}
+}
+
+// Create Events from an attached iCalendar file
+func importCommand(ctx *CommandContext, attachment *discordgo.MessageAttachment) {
+	if attachment == nil || !strings.HasSuffix(strings.ToLower(attachment.Filename), ".ics") {
+		ctx.reply("Usage: attach one .ics file to a message that says !event import")
+		return
+	}
+	if attachment.Size > maxImportSize {
+		ctx.reply("That file is too big to import.")
+		return
+	}
+
+	data, err := DownloadICS(attachment.URL)
+	if err != nil {
+		ctx.reply(err.Error())
+		return
+	}
+	loc, err := RetrieveGuildTimezone(ctx.guildID)
+	if err != nil {
+		ctx.reply(err.Error())
+		return
+	}
+
+	report, err := ImportICS(ctx.guildID, data, loc, ctx.user.Username, ctx.user.ID, time.Now())
+	if err != nil && (report == nil || len(report.imported) == 0) {
+		ctx.reply(err.Error())
+		return
+	}
+	if err != nil {
+		// Let the user know which events made it in, so trying again doesn't import them twice
+		ctx.reply(report.String() + "Stopped importing because of an error: " + err.Error())
+		return
+	}
+	ctx.reply(report.String())
+}
+
+// List a page of Events matching a filter
+func listCommand(ctx *CommandContext, filter EventFilter, page int) {
+	title := "Upcoming events"
+	if filter.past {
+		title = "Past events"
+	}
+	if filter.creatorID != "" {
+		title += " you created"
+	}
+	if filter.rsvpUserID != "" {
+		title += " you RSVPed to"
+	}
+
+	events, more, err := ListEvents(filter, time.Now(), page)
+	if err != nil {
+		ctx.reply(err.Error())
+		return
+	}
+	if len(events) == 0 {
+		ctx.reply("No events found.")
+		return
+	}
+
+	var buffer bytes.Buffer
+	buffer.WriteString("__" + title + "__ (page " + strconv.Itoa(page) + ")\n")
+	for _, event := range events {
+		buffer.WriteString(
+			"ID: " + strconv.FormatInt(event.id, 10) + " `**" + event.name + "** on " + event.When() + "`\n")
+	}
+	if more {
+		buffer.WriteString("More events on page " + strconv.Itoa(page+1) + ".")
+	}
+	ctx.reply(buffer.String())
+}
+
+// Show the guild's timezone, or change it if a new one is given
+func timezoneCommand(ctx *CommandContext, timezone string) {
+	if timezone == "" {
+		loc, err := RetrieveGuildTimezone(ctx.guildID)
+		if err != nil {
+			ctx.reply(err.Error())
+			return
+		}
+		ctx.reply("Events on this server use the " + loc.String() + " timezone.")
+		return
+	}
+
+	if !canManageServer(ctx) {
+		ctx.reply("You need the Manage Server permission to change the timezone.")
+		return
+	}
+
+	loc, err := time.LoadLocation(strings.TrimSpace(timezone))
+	if err != nil {
+		ctx.reply("Unknown timezone.  Use a name from the tz database such as America/New_York or Europe/London.")
+		return
+	}
+	if err := UpdateGuildTimezone(ctx.guildID, loc.String()); err != nil {
+		ctx.reply(err.Error())
+		return
+	}
+	ctx.reply("New events on this server will use the " + loc.String() + " timezone.")
+}
+
+// Show the guild's announcement channel, or change it if a new one (or "none") is given
+func channelCommand(ctx *CommandContext, channelID string) {
+	if channelID == "" {
+		channelID, err := RetrieveGuildAnnounceChannel(ctx.guildID)
+		if err != nil {
+			ctx.reply(err.Error())
+			return
+		}
+		if channelID == "" {
+			ctx.reply("New events on this server aren't announced.")
+		} else {
+			ctx.reply("New events on this server are announced in <#" + channelID + ">.")
+		}
+		return
+	}
+
+	if !canManageServer(ctx) {
+		ctx.reply("You need the Manage Server permission to change the announcement channel.")
+		return
+	}
+
+	// Accept a channel mention, a bare channel ID, or "none" to stop announcing events
+	channelID = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(channelID), "<#"), ">")
+	if strings.ToLower(channelID) == "none" || strings.ToLower(channelID) == "off" {
+		channelID = ""
+	} else {
+		channel, err := ctx.session.Channel(channelID)
+		if err != nil || channel.GuildID != ctx.guildID {
+			ctx.reply("I couldn't find that channel on this server.")
+			return
+		}
+	}
+	if err := UpdateGuildAnnounceChannel(ctx.guildID, channelID); err != nil {
+		ctx.reply(err.Error())
+		return
+	}
+	if channelID == "" {
+		ctx.reply("New events on this server will no longer be announced.")
+	} else {
+		ctx.reply("New events on this server will be announced in <#" + channelID + ">.  " +
+			"React to an announcement to RSVP.")
+	}
+}
+
+// Privately send a server manager the link to the guild's calendar feed, turning the feed on, giving it a new link
+// or turning it off first if they ask
+func feedCommand(ctx *CommandContext, action string) {
+	if CALENDAR_URL == "" {
+		ctx.reply("This bot doesn't serve calendar feeds.")
+		return
+	}
+	// Anyone with the link can see every upcoming event on the server, so only managers get it
+	if !canManageServer(ctx) {
+		ctx.reply("You need the Manage Server permission to use the calendar feed.")
+		return
+	}
+
+	token, err := RetrieveCalendarToken(ctx.guildID)
+	if err != nil {
+		ctx.reply(err.Error())
+		return
+	}
+
+	action = strings.ToLower(strings.TrimSpace(action))
+	switch action {
+	case "":
+		if token == "" {
+			ctx.reply("The calendar feed is off.  Turn it on with !event feed on")
+			return
+		}
+	case "on", "reset":
+		if token == "" || action == "reset" {
+			token, err = newCalendarToken()
+			if err == nil {
+				err = UpdateCalendarToken(ctx.guildID, token)
+			}
+			if err != nil {
+				ctx.reply(err.Error())
+				return
+			}
+		}
+	case "off":
+		if err := UpdateCalendarToken(ctx.guildID, ""); err != nil {
+			ctx.reply(err.Error())
+			return
+		}
+		ctx.reply("The calendar feed is off, and its link no longer works.")
+		return
+	default:
+		ctx.reply("Usage: !event feed [on|reset|off]")
+		return
+	}
+
+	ctx.private("Subscribe to this server's events in a calendar app with " + CalendarFeedURL(ctx.guildID, token) +
+		"\nAnyone with the link can see every upcoming event, so only share it with people you trust.  " +
+		"If it gets out, get a new link with !event feed reset")
+	if action == "reset" {
+		ctx.reply("The calendar feed has a new link, and the old one no longer works.  I've sent you the new one.")
+	} else {
+		ctx.reply("I've sent you the link to the calendar feed.")
+	}
+}
+
+func helpCommand(ctx *CommandContext) {
+	ctx.reply(
+		"__Discord Event Planner created by Mongoose__" + "\n```" +
+			"**Create event:** !event create name|description|location|date|time[|maxAttendees]" + "\n" +
+			"**Dates/times:**  2026-10-21, Oct 21, tomorrow, next friday / 7pm, 19:30" + "\n" +
+			"**Timezone:**     !event timezone [America/New_York]" + "\n" +
+			"**Announcements** !event channel [#channel|none]" + "\n" +
+			"**Edit event:**   !event edit eventID[@date]|field=value[|field=value...]" + "\n" +
+			"**Repeat event:** !event edit eventID|repeat=weekly on mon,thu until dec 31" + "\n" +
+			"**Cancel event**  !event cancel eventID[@date][|reason]" + "\n" +
+			"**Undo cancel**   !event restore eventID" + "\n" +
+			"**Co-hosts**      !event cohost add|remove eventID|@user" + "\n" +
+			"**Give away**     !event transfer eventID|@user" + "\n" +
+			"**Managers**      !event managers [add|remove @role]" + "\n" +
+			"**Show event**    !event info eventID  OR  !event info eventName" + "\n" +
+			"**History**       !event history eventID" + "\n" +
+			"**List events**   !event list [upcoming|past] [mine] [rsvp] [page]" + "\n" +
+			"**Calendar file** !event ics eventID" + "\n" +
+			"**Import events** !event import (with an .ics file attached)" + "\n" +
+			"**Calendar feed** !event feed [on|reset|off]" + "\n" +
+			"**RSVP**          !event rsvp eventID[@date]|choice OR  !rsvp eventName|choice" + "\n" +
+			"**RSVP choices:** G[oing], M[aybe], N[ot going]" + "\n" +
+			"**RSVP by reacting** to an announcement: ✅ Going, ❔ Maybe, ❌ Not going" + "\n" +
+			"Every command is also available as a slash command, e.g. /event create" + "```")
+}
@@ -6,82 +6,177 @@ import (
 
 	"github.com/bwmarrin/discordgo"
 
-	"bytes"
 	"errors"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
-var (
-	eventDB *sql.DB = OpenDB("./db/events.sqlite")
+// An EventStore backed by SQLite or PostgreSQL
+type SQLEventStore struct {
+	*sqlDB
+}
+
+const (
+	eventColumns = `id, guild_id, name, description, location, starts_at, timezone, max_attendees, recurrence, creator,
+        creator_id, announce_channel_id, announce_message_id, status, cancel_reason, cancelled_at`
+	rsvpColumns = `id, event_id, occurrence, username, user_id, status`
+
+	// Number of Events shown per page by !event list
+	eventsPerPage = 10
+
+	// What has become of an Event.  Cancelled Events are kept so they can be restored, but are left out of searches
+	// and lists.  Events that don't repeat are completed once they have started.
+	EventScheduled = "scheduled"
+	EventCancelled = "cancelled"
+	EventCompleted = "completed"
 )
 
 // An Event represents a date and time when one or more people will convene at a certain location
+// A recurring Event is a series, and each of its occurrences is represented by a copy of the series' Event
 type Event struct {
-	id          int64
-	name        string
-	description string
-	location    string
-	date        string
-	time        string
-	creator     string
-	creatorID   string
+	id           int64
+	guildID      string
+	name         string
+	description  string
+	location     string
+	startsAt     time.Time
+	timezone     string
+	maxAttendees int64       // 0 if there is no limit
+	recurrence   *Recurrence // nil if the Event doesn't repeat
+	creator      string
+	creatorID    string
+
+	announceChannelID string // where the Event was announced, empty if it wasn't
+	announceMessageID string
+
+	status       string    // EventScheduled, EventCancelled or EventCompleted
+	cancelReason string    // why the Event was cancelled, if whoever cancelled it said
+	cancelledAt  time.Time // zero unless the Event is cancelled
+
+	occurrence int64  // the original start time of this occurrence of a series, 0 for the series itself
+	series     *Event // the series this is an occurrence of, nil for the series itself
+}
+
+// A ColumnChange is a new value for one column of an Event or of one of its occurrences
+type ColumnChange struct {
+	column string
+	value  interface{}
 }
 
 // An RSVP is a response from a person to a specific Event specifying if they are going, might be going, or not going
+// Going responses to a full Event are Waitlisted until a spot opens up
+// RSVPs to a recurring Event are for one occurrence of it
 type RSVP struct {
-	id       int64
-	eventID  string
-	username string
-	userID   string
-	status   string
+	id         int64
+	eventID    string
+	occurrence int64 // 0 for Events that don't repeat
+	username   string
+	userID     string
+	status     string
 }
 
-// Create a new Event in the DB and return a pointer to it
-func CreateEvent(name, description, location, event_date, event_time, creator, creator_id string) (*Event, error) {
-	stmt, err := eventDB.Prepare(
-		`INSERT INTO events (name, description, location, event_date, event_time, creator, creator_id)
-        VALUES (?, ?, ?, ?, ?, ?, ?)`)
+// Create a new Event in a guild in the DB and return a pointer to it
+func (store *SQLEventStore) CreateEvent(guildID, name, description, location string, startsAt time.Time,
+	timezone string, maxAttendees int64, creator, creator_id string) (*Event, error) {
+	return store.createEvent(guildID, name, description, location, startsAt, timezone, maxAttendees, creator,
+		creator_id, nil, nil)
+}
+
+// Create a recurring Event in the DB with some of its occurrences already cancelled, all in one transaction
+func (store *SQLEventStore) CreateSeries(guildID, name, description, location string, startsAt time.Time,
+	timezone string, maxAttendees int64, creator, creatorID string, rule *Recurrence,
+	cancelled []int64) (*Event, error) {
+	return store.createEvent(guildID, name, description, location, startsAt, timezone, maxAttendees, creator,
+		creatorID, rule, cancelled)
+}
+
+func (store *SQLEventStore) createEvent(guildID, name, description, location string, startsAt time.Time,
+	timezone string, maxAttendees int64, creator, creator_id string, rule *Recurrence,
+	cancelled []int64) (*Event, error) {
+	stmt, err := store.prepareInsert(
+		`INSERT INTO events (guild_id, name, description, location, starts_at, timezone, max_attendees, creator,
+        creator_id, recurrence) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return nil, err
+	}
+	exceptionStmt, err := store.prepare(`INSERT INTO event_exceptions (event_id, occurrence, cancelled)
+        VALUES (?, ?, 1) ON CONFLICT (event_id, occurrence) DO NOTHING`)
 	if err != nil {
 		return nil, err
 	}
 
-	tx, err := eventDB.Begin()
+	recurrence := ""
+	if rule != nil {
+		recurrence = rule.String()
+	}
+
+	tx, err := store.db.Begin()
 	if err != nil {
 		return nil, err
 	}
 
-	result, err := tx.Stmt(stmt).Exec(name, description, location, event_date, event_time, creator, creator_id)
+	id, err := store.insert(tx, stmt, guildID, name, description, location, startsAt.Unix(), timezone, maxAttendees,
+		creator, creator_id, recurrence)
+	for _, occurrence := range cancelled {
+		if err == nil {
+			_, err = tx.Stmt(exceptionStmt).Exec(id, occurrence)
+		}
+	}
+	if err == nil {
+		err = store.audit(tx, &AuditEntry{eventID: id, userID: creator_id, action: AuditCreate, newValue: name})
+	}
 	if err != nil {
 		tx.Rollback()
 		return nil, err
 	}
 
-	tx.Commit()
-	id, err := result.LastInsertId()
+	err = tx.Commit()
 	if err != nil {
 		return nil, err
 	}
 
-	event := Event{id, name, description, location, event_date, event_time, creator, creator_id}
+	event := Event{
+		id:           id,
+		guildID:      guildID,
+		name:         name,
+		description:  description,
+		location:     location,
+		startsAt:     startsAt.UTC(),
+		timezone:     timezone,
+		maxAttendees: maxAttendees,
+		creator:      creator,
+		creatorID:    creator_id,
+		status:       EventScheduled,
+		recurrence:   rule,
+	}
 	return &event, err
 }
 
-// Get an Event from the DB using either the Event's ID or its name (or part of it)
+// Get an Event in a guild from the DB using either the Event's ID or its name (or part of it)
 // Returns a slice in case a name search returns more than one result
-func RetrieveEvent(eventSearch string) ([]*Event, error) {
+func RetrieveEvent(guildID string, eventSearch string) ([]*Event, error) {
 	if _, err := strconv.ParseInt(eventSearch, 10, 64); err != nil {
 		// eventSearch is not numeric, use RetrieveEventByName
-		return RetrieveEventByName(eventSearch)
+		return eventStore.RetrieveEventByName(guildID, eventSearch)
 	} else {
-		event, err := RetrieveEventByID(eventSearch)
-		return []*Event{event}, err
+		event, err := eventStore.RetrieveEventByID(eventSearch)
+		if err == sql.ErrNoRows || (err == nil && event.guildID != guildID) {
+			// Events in other guilds are treated as if they don't exist
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return []*Event{event}, nil
 	}
 }
 
-// Get an Event from the DB using its unique ID
-func RetrieveEventByID(id string) (*Event, error) {
-	stmt, err := eventDB.Prepare(`SELECT * FROM events WHERE id=?`)
+// Get an Event from the DB using its unique ID, whichever guild it is in
+// Lookups on behalf of a user should go through RetrieveEvent so they only find Events in the user's guild
+func (store *SQLEventStore) RetrieveEventByID(id string) (*Event, error) {
+	stmt, err := store.prepare(`SELECT ` + eventColumns + ` FROM events WHERE id=?`)
 	if err != nil {
 		return nil, err
 	}
@@ -91,25 +186,42 @@ func RetrieveEventByID(id string) (*Event, error) {
 		return nil, errors.New("Event not found.")
 	}
 
-	var event Event
-	err = result.Scan(&event.id, &event.name, &event.description, &event.location, &event.date, &event.time,
-		&event.creator, &event.creatorID)
+	return scanEvent(result)
+}
+
+// Get the Event that was announced in a message
+func (store *SQLEventStore) RetrieveEventByAnnouncement(messageID string) (*Event, error) {
+	stmt, err := store.prepare(`SELECT ` + eventColumns + ` FROM events WHERE announce_message_id=?`)
 	if err != nil {
 		return nil, err
 	}
 
-	return &event, nil
+	return scanEvent(stmt.QueryRow(messageID))
 }
 
-// Get an Event from the DB using a search by name or partial name
+// Get an Event in a guild from the DB using a search by name or partial name
 // Returns a slice in case there are multiple results returned by the search
-func RetrieveEventByName(name string) ([]*Event, error) {
-	stmt, err := eventDB.Prepare(`SELECT * FROM events WHERE name LIKE ?`)
+func (store *SQLEventStore) RetrieveEventByName(guildID string, name string) ([]*Event, error) {
+	return store.queryEvents(`SELECT `+eventColumns+` FROM events WHERE guild_id=? AND LOWER(name) LIKE LOWER(?)
+        AND status<>'cancelled' ORDER BY id`, guildID, "%"+name+"%")
+}
+
+// Get the Events in a guild with exactly this name and start time
+func (store *SQLEventStore) RetrieveEventByNameAndStart(guildID string, name string,
+	startsAt time.Time) ([]*Event, error) {
+	return store.queryEvents(`SELECT `+eventColumns+` FROM events WHERE guild_id=? AND name=? AND starts_at=?
+        AND status<>'cancelled'`,
+		guildID, name, startsAt.Unix())
+}
+
+// Get all Events returned by a query that selects eventColumns
+func (store *SQLEventStore) queryEvents(query string, args ...interface{}) ([]*Event, error) {
+	stmt, err := store.prepare(query)
 	if err != nil {
 		return nil, err
 	}
 
-	result, err := stmt.Query("%" + name + "%")
+	result, err := stmt.Query(args...)
 	if err != nil {
 		return nil, err
 	}
@@ -118,13 +230,11 @@ func RetrieveEventByName(name string) ([]*Event, error) {
 
 	defer result.Close()
 	for result.Next() {
-		var event Event
-		err := result.Scan(&event.id, &event.name, &event.description, &event.location, &event.date,
-			&event.time, &event.creator, &event.creatorID)
+		event, err := scanEvent(result)
 		if err != nil {
 			return nil, err
 		}
-		events = append(events, &event)
+		events = append(events, event)
 	}
 	err = result.Err()
 	if err != nil {
@@ -134,132 +244,602 @@ func RetrieveEventByName(name string) ([]*Event, error) {
 	return events, nil
 }
 
-// Cancel and remove an Event from the DB
-func CancelEvent(id string) error {
-	stmt, err := eventDB.Prepare(`DELETE FROM events WHERE id=?`)
+// A row or set of rows that can be scanned into an Event
+type eventScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// Scan the columns listed in eventColumns into a new Event
+func scanEvent(row eventScanner) (*Event, error) {
+	var event Event
+	var startsAt, cancelledAt int64
+	var recurrence string
+	err := row.Scan(&event.id, &event.guildID, &event.name, &event.description, &event.location, &startsAt,
+		&event.timezone, &event.maxAttendees, &recurrence, &event.creator, &event.creatorID,
+		&event.announceChannelID, &event.announceMessageID, &event.status, &event.cancelReason, &cancelledAt)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	event.startsAt = time.Unix(startsAt, 0).UTC()
+	if cancelledAt != 0 {
+		event.cancelledAt = time.Unix(cancelledAt, 0).UTC()
+	}
+	if recurrence != "" {
+		event.recurrence, err = ParseRRule(recurrence, LoadTimezone(event.timezone))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &event, nil
+}
+
+// Criteria for listing Events with ListEvents
+type EventFilter struct {
+	guildID    string // only list Events in this guild
+	past       bool   // list Events that have already started instead of upcoming ones
+	creatorID  string // only list Events created by this user
+	rsvpUserID string // only list Events this user is going to or might be going to
+}
+
+// Get a page of Events matching a filter, sorted by start time (most recent first for past Events)
+// Recurring Events are expanded into their occurrences.  Also returns whether there are more pages after this one.
+func ListEvents(filter EventFilter, now time.Time, page int) ([]*Event, bool, error) {
+	// Enough Events to fill every page up to this one, plus one to find out if there is another page
+	want := page*eventsPerPage + 1
+
+	var rsvped map[string]bool
+	if filter.rsvpUserID != "" {
+		var err error
+		rsvped, err = retrieveRSVPedOccurrences(filter.rsvpUserID)
+		if err != nil {
+			return nil, false, err
+		}
 	}
 
-	_, err = stmt.Exec(id)
+	events, err := eventStore.RetrieveSingleEvents(filter, now, want)
 	if err != nil {
-		return errors.New("Event not found.")
+		return nil, false, err
+	}
+	series, err := eventStore.RetrieveSeries(filter)
+	if err != nil {
+		return nil, false, err
 	}
 
-	return nil
+	for _, event := range series {
+		var occurrences []*Event
+		if filter.past {
+			occurrences, err = ExpandEvent(event, time.Time{}, now, 0)
+		} else if rsvped != nil {
+			occurrences, err = ExpandEvent(event, now, time.Time{}, 0)
+		} else {
+			occurrences, err = ExpandEvent(event, now, time.Time{}, want)
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		for _, occurrence := range occurrences {
+			if rsvped == nil || rsvped[occurrenceKey(occurrence.id, occurrence.occurrence)] {
+				events = append(events, occurrence)
+			}
+		}
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		if filter.past {
+			return events[i].startsAt.After(events[j].startsAt)
+		}
+		return events[i].startsAt.Before(events[j].startsAt)
+	})
+
+	first := (page - 1) * eventsPerPage
+	if first >= len(events) {
+		return nil, false, nil
+	}
+	if len(events) > first+eventsPerPage {
+		return events[first : first+eventsPerPage], true, nil
+	}
+	return events[first:], false, nil
 }
 
-func UpdateEventDescription(id string, newDescription string) error {
-	return updateEventColumn(id, "description", newDescription)
+// Get the Events matching a filter that don't repeat, upcoming ones soonest first or past ones most recent first
+func (store *SQLEventStore) RetrieveSingleEvents(filter EventFilter, now time.Time, limit int) ([]*Event, error) {
+	query := `SELECT ` + eventColumns + ` FROM events WHERE guild_id=? AND status<>'cancelled' AND recurrence=''
+        AND starts_at>=?`
+	order := ` ORDER BY starts_at ASC, id`
+	if filter.past {
+		query = `SELECT ` + eventColumns + ` FROM events WHERE guild_id=? AND status<>'cancelled' AND recurrence=''
+        AND starts_at<?`
+		order = ` ORDER BY starts_at DESC, id`
+	}
+	query, args := filter.where(query, filter.guildID, now.Unix())
+	if limit > 0 {
+		order += ` LIMIT ?`
+		args = append(args, limit)
+	}
+	return store.queryEvents(query+order, args...)
 }
 
-func UpdateEventLocation(id string, newLocation string) error {
-	return updateEventColumn(id, "location", newLocation)
+// Get the recurring Events matching a filter
+func (store *SQLEventStore) RetrieveSeries(filter EventFilter) ([]*Event, error) {
+	query, args := filter.where(`SELECT `+eventColumns+` FROM events WHERE guild_id=? AND status<>'cancelled'
+        AND recurrence<>''`, filter.guildID)
+	return store.queryEvents(query+` ORDER BY id`, args...)
 }
 
-func UpdateEventDate(id string, newDate string) error {
-	return updateEventColumn(id, "event_date", newDate)
+// Add the conditions for a filter's creator and RSVPed user to a query on events
+func (filter EventFilter) where(query string, args ...interface{}) (string, []interface{}) {
+	if filter.creatorID != "" {
+		query += ` AND creator_id=?`
+		args = append(args, filter.creatorID)
+	}
+	if filter.rsvpUserID != "" {
+		query += ` AND id IN (SELECT event_id FROM rsvps WHERE user_id=? AND status IN ('Going', 'Maybe'))`
+		args = append(args, filter.rsvpUserID)
+	}
+	return query, args
 }
 
-func UpdateEventTime(id string, newTime string) error {
-	return updateEventColumn(id, "event_time", newTime)
+// Get every Event in a guild that hasn't started yet, and every recurring Event that still has occurrences to come
+func RetrieveUpcomingEvents(guildID string, now time.Time) ([]*Event, error) {
+	events, err := eventStore.RetrieveSingleEvents(EventFilter{guildID: guildID}, now, 0)
+	if err != nil {
+		return nil, err
+	}
+	series, err := eventStore.RetrieveSeries(EventFilter{guildID: guildID})
+	if err != nil {
+		return nil, err
+	}
+
+	upcoming := events
+	for _, event := range series {
+		if _, err := NextOccurrence(event, now); err == nil {
+			upcoming = append(upcoming, event)
+		}
+	}
+	sort.SliceStable(upcoming, func(i, j int) bool {
+		if upcoming[i].startsAt.Equal(upcoming[j].startsAt) {
+			return upcoming[i].id < upcoming[j].id
+		}
+		return upcoming[i].startsAt.Before(upcoming[j].startsAt)
+	})
+	return upcoming, nil
 }
 
-func updateEventColumn(id string, columnName string, newValue string) error {
-	stmt, err := eventDB.Prepare(`UPDATE events SET ` + columnName + `=? WHERE id=?`)
-	PanicIf(err)
+// Move Events created before Events were scoped to guilds into a guild
+// Returns how many Events were moved
+func (store *SQLEventStore) AssignUnscopedEvents(guildID string) (int64, error) {
+	stmt, err := store.prepare(`UPDATE events SET guild_id=? WHERE guild_id=''`)
+	if err != nil {
+		return 0, err
+	}
 
-	tx, err := eventDB.Begin()
-	PanicIf(err)
+	result, err := stmt.Exec(guildID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
 
-	_, err = tx.Stmt(stmt).Exec(newValue, id)
+// Mark an Event as cancelled in the DB, keeping its RSVPs and changes to its occurrences so it can be restored.  Its
+// pending Reminders are removed, and rescheduled if it is restored.
+func (store *SQLEventStore) CancelEvent(id string, reason string, cancelledAt time.Time, userID string) error {
+	stmt, err := store.prepare(`UPDATE events SET status=?, cancel_reason=?, cancelled_at=? WHERE id=?`)
+	if err != nil {
+		return err
+	}
+	reminderStmt, err := store.prepare(`DELETE FROM reminders WHERE event_id=?`)
+	if err != nil {
+		return err
+	}
 
+	tx, err := store.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Stmt(stmt).Exec(EventCancelled, reason, cancelledAt.Unix(), id)
 	if err == nil {
-		tx.Commit()
-	} else {
+		_, err = tx.Stmt(reminderStmt).Exec(id)
+	}
+	if err == nil {
+		eventID, _ := strconv.ParseInt(id, 10, 64)
+		err = store.audit(tx, &AuditEntry{eventID: eventID, userID: userID, action: AuditCancel, newValue: reason})
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		tx.Rollback()
+		return errors.New("Event not found.")
+	}
+
+	return tx.Commit()
+}
+
+// Put a cancelled Event back on the schedule in the DB
+func (store *SQLEventStore) RestoreEvent(id string, userID string) error {
+	stmt, err := store.prepare(`UPDATE events SET status=?, cancel_reason='', cancelled_at=0 WHERE id=? AND status=?`)
+	if err != nil {
+		return err
+	}
+
+	tx, err := store.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Stmt(stmt).Exec(EventScheduled, id, EventCancelled)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if updated, _ := result.RowsAffected(); updated == 0 {
 		tx.Rollback()
+		return errors.New("That event isn't cancelled.")
+	}
+	eventID, _ := strconv.ParseInt(id, 10, 64)
+	err = store.audit(tx, &AuditEntry{eventID: eventID, userID: userID, action: AuditRestore})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Mark the Events that don't repeat and have started by now as completed in the DB
+// Returns how many were completed
+func (store *SQLEventStore) CompletePastEvents(now time.Time) (int64, error) {
+	stmt, err := store.prepare(`UPDATE events SET status=? WHERE status=? AND recurrence='' AND starts_at<?`)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := stmt.Exec(EventCompleted, EventScheduled, now.Unix())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// Remember the message an Event was announced in so reactions to it can be turned into RSVPs
+func UpdateEventAnnouncement(id string, channelID string, messageID string) error {
+	return eventStore.UpdateEventColumns(id,
+		[]ColumnChange{{"announce_channel_id", channelID}, {"announce_message_id", messageID}}, "")
+}
+
+// Make an Event repeat according to a Recurrence, or stop it repeating if rule is nil
+func UpdateEventRecurrence(id string, rule *Recurrence, editorID string) error {
+	if rule == nil {
+		return eventStore.UpdateEventColumns(id, []ColumnChange{{"recurrence", ""}}, editorID)
+	}
+	return eventStore.UpdateEventColumns(id, []ColumnChange{{"recurrence", rule.String()}}, editorID)
+}
+
+// Change several columns of an Event in the DB in one transaction, recording each change in its history.  Changes
+// the bot makes on its own, like remembering where an Event was announced, are made with no editorID and left out of
+// the Event's history.
+func (store *SQLEventStore) UpdateEventColumns(id string, changes []ColumnChange, editorID string) error {
+	tx, err := store.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	eventID, _ := strconv.ParseInt(id, 10, 64)
+	for _, change := range changes {
+		if editorID != "" {
+			var oldValue sql.NullString
+			err = tx.QueryRow(store.rebind(`SELECT `+change.column+` FROM events WHERE id=?`), id).Scan(&oldValue)
+			if err == nil {
+				err = store.audit(tx, &AuditEntry{eventID: eventID, userID: editorID, action: AuditEdit,
+					field: change.column, oldValue: oldValue.String, newValue: auditValue(change.value)})
+			} else if err == sql.ErrNoRows {
+				// Like an UPDATE that matches no rows, there is nothing to record
+				err = nil
+			}
+		}
+		if err == nil {
+			_, err = tx.Exec(store.rebind(`UPDATE events SET `+change.column+`=? WHERE id=?`), change.value, id)
+		}
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
 	}
-	return err
+
+	return tx.Commit()
 }
 
 func (event *Event) String() string {
-	return "__**"+event.name +"**__\n"+
-		"**Created by:** "+event.creator+"\n" +
-		"**When:** "+event.date+" at "+event.time+"\n"+
-		"**Where:** "+event.location+"\n"+
-		"**Description:** "+event.description+"\n"
+	return "__**" + event.name + "**__\n" +
+		event.statusLine() +
+		"**Created by:** " + event.creator + "\n" +
+		"**When:** " + event.When() + "\n" +
+		event.recurrenceLine() +
+		"**Where:** " + event.location + "\n" +
+		event.capacityLine() +
+		"**Description:** " + event.description + "\n"
+}
+
+// When and why an Event was cancelled, or nothing if it wasn't
+func (event *Event) statusLine() string {
+	if event.status != EventCancelled {
+		return ""
+	}
+	line := "**Cancelled:** " + event.cancelledAt.In(LoadTimezone(event.timezone)).Format(eventTimeLayout)
+	if event.cancelReason != "" {
+		line += " (" + event.cancelReason + ")"
+	}
+	return line + "\n"
+}
+
+func (event *Event) recurrenceLine() string {
+	if event.recurrence == nil {
+		return ""
+	}
+	return "**Repeats:** " + event.recurrence.Describe(LoadTimezone(event.timezone)) + "\n"
+}
+
+// The next few dates of a recurring Event, or nothing if it doesn't repeat
+func (event *Event) upcomingLine(now time.Time) string {
+	if event.recurrence == nil {
+		return ""
+	}
+	occurrences, err := ExpandEvent(event.seriesEvent(), now, time.Time{}, 5)
+	if err != nil || len(occurrences) == 0 {
+		return ""
+	}
+	var dates []string
+	for _, occurrence := range occurrences {
+		dates = append(dates, occurrence.LocalTime().Format("Mon Jan 2"))
+	}
+	return "**Upcoming dates:** " + strings.Join(dates, ", ") + "\n"
+}
+
+// The series a recurring Event's occurrence belongs to, or the Event itself
+func (event *Event) seriesEvent() *Event {
+	if event.series != nil {
+		return event.series
+	}
+	return event
+}
+
+func (event *Event) capacityLine() string {
+	if event.maxAttendees == 0 {
+		return ""
+	}
+	return "**Spots:** " + strconv.FormatInt(event.maxAttendees, 10) + "\n"
+}
+
+// The Event's start time in the timezone it was created in
+func (event *Event) LocalTime() time.Time {
+	return event.startsAt.In(LoadTimezone(event.timezone))
+}
+
+// The Event's start time formatted for display
+func (event *Event) When() string {
+	return event.LocalTime().Format(eventTimeLayout)
 }
 
-// Create an RSVP to the specified Event in the DB
-func CreateRSVP(eventID string, username string, userID string, status string) (*RSVP, error) {
-	stmt, err := eventDB.Prepare(
-		`INSERT INTO rsvps (event_id, username, user_id, status)
-        VALUES (?, ?, ?, ?)`)
+// Create an RSVP to the specified Event (or occurrence of a recurring Event) in the DB
+// A Going RSVP to an Event that is already full is put on the waitlist instead
+func (store *SQLEventStore) CreateRSVP(eventID string, occurrence int64, username string, userID string,
+	status string) (*RSVP, error) {
+	stmt, err := store.prepareInsert(
+		`INSERT INTO rsvps (event_id, occurrence, username, user_id, status, waitlisted_at)
+        VALUES (?, ?, ?, ?, ?, ?)`)
 	if err != nil {
 		return nil, err
 	}
 
-	tx, err := eventDB.Begin()
+	tx, err := store.db.Begin()
 	if err != nil {
 		return nil, err
 	}
 
-	result, err := tx.Stmt(stmt).Exec(eventID, username, userID, status)
+	status, err = store.applyCapacity(tx, eventID, occurrence, 0, status)
 	if err != nil {
 		tx.Rollback()
 		return nil, err
 	}
 
-	tx.Commit()
-	id, err := result.LastInsertId()
+	id, err := store.insert(tx, stmt, eventID, occurrence, username, userID, status, time.Now().UnixNano())
+	if err == nil {
+		err = store.auditRSVP(tx, eventID, occurrence, userID, "", status)
+	}
 	if err != nil {
+		tx.Rollback()
 		return nil, err
 	}
 
-	rsvp := RSVP{id, eventID, username, userID, status}
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	rsvp := RSVP{id, eventID, occurrence, username, userID, status}
 	return &rsvp, err
 }
 
-// Update an existing RSVP in the DB by setting a new status
-func UpdateRSVP(id string, status string) error {
-	stmt, err := eventDB.Prepare(`UPDATE rsvps SET status=? WHERE id=?`)
+// Update an existing RSVP in the DB by setting a new status and return the updated RSVP
+// Changing to Going when the Event is full puts the RSVP on the waitlist instead
+func (store *SQLEventStore) UpdateRSVP(id string, status string) (*RSVP, error) {
+	stmt, err := store.prepare(
+		`UPDATE rsvps SET status=?, waitlisted_at=CASE WHEN status='Waitlisted' THEN waitlisted_at ELSE ? END
+        WHERE id=?`)
 	PanicIf(err)
 
-	tx, err := eventDB.Begin()
+	tx, err := store.db.Begin()
 	PanicIf(err)
 
-	_, err = tx.Stmt(stmt).Exec(status, id)
+	rsvp, err := scanRSVP(tx.QueryRow(store.rebind(`SELECT `+rsvpColumns+` FROM rsvps WHERE id=?`), id))
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if rsvp.status == "Waitlisted" && status == "Going" {
+		// Already waiting for a spot, keep their place in line
+		tx.Rollback()
+		return rsvp, nil
+	}
+
+	status, err = store.applyCapacity(tx, rsvp.eventID, rsvp.occurrence, rsvp.id, status)
+	if err == nil {
+		_, err = tx.Stmt(stmt).Exec(status, time.Now().UnixNano(), id)
+	}
+	if err == nil && status != rsvp.status {
+		err = store.auditRSVP(tx, rsvp.eventID, rsvp.occurrence, rsvp.userID, rsvp.status, status)
+	}
 
 	if err == nil {
 		tx.Commit()
 	} else {
 		tx.Rollback()
+		return nil, err
+	}
+
+	rsvp.status = status
+	return rsvp, nil
+}
+
+// Return the status an RSVP should actually be stored with, given how many people are already going to the Event
+func (store *SQLEventStore) applyCapacity(tx *sql.Tx, eventID string, occurrence int64, rsvpID int64,
+	status string) (string, error) {
+	if status != "Going" {
+		return status, nil
+	}
+
+	var maxAttendees, going int64
+	err := tx.QueryRow(store.rebind(`SELECT max_attendees FROM events WHERE id=?`), eventID).Scan(&maxAttendees)
+	if err != nil {
+		return "", err
+	}
+	if maxAttendees == 0 {
+		return status, nil
+	}
+
+	err = tx.QueryRow(store.rebind(`SELECT COUNT(*) FROM rsvps WHERE event_id=? AND occurrence=? AND status='Going'
+        AND id<>?`), eventID, occurrence, rsvpID).Scan(&going)
+	if err != nil {
+		return "", err
+	}
+	if going >= maxAttendees {
+		return "Waitlisted", nil
+	}
+	return status, nil
+}
+
+// Move people off an Event's waitlist, in the order they joined it, until the Event is full again
+// Returns the RSVPs that were promoted so they can be notified
+func (store *SQLEventStore) PromoteWaitlist(eventID string, occurrence int64) ([]*RSVP, error) {
+	tx, err := store.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var maxAttendees, going int64
+	err = tx.QueryRow(store.rebind(`SELECT max_attendees FROM events WHERE id=?`), eventID).Scan(&maxAttendees)
+	if err != nil {
+		return nil, err
+	}
+	err = tx.QueryRow(store.rebind(`SELECT COUNT(*) FROM rsvps WHERE event_id=? AND occurrence=? AND status='Going'`),
+		eventID, occurrence).Scan(&going)
+	if err != nil {
+		return nil, err
+	}
+
+	openSpots := maxAttendees - going
+	if maxAttendees == 0 {
+		openSpots = -1 // no limit, everyone on the waitlist gets in
+	} else if openSpots <= 0 {
+		return nil, nil
+	}
+
+	query := `SELECT ` + rsvpColumns + ` FROM rsvps WHERE event_id=? AND occurrence=? AND status='Waitlisted'
+        ORDER BY waitlisted_at, id`
+	args := []interface{}{eventID, occurrence}
+	if openSpots > 0 {
+		query += ` LIMIT ?`
+		args = append(args, openSpots)
+	}
+	result, err := tx.Query(store.rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var promoted []*RSVP
+	for result.Next() {
+		rsvp, err := scanRSVP(result)
+		if err != nil {
+			result.Close()
+			return nil, err
+		}
+		rsvp.status = "Going"
+		promoted = append(promoted, rsvp)
+	}
+	result.Close()
+	err = result.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, rsvp := range promoted {
+		_, err = tx.Exec(store.rebind(`UPDATE rsvps SET status='Going' WHERE id=?`), rsvp.id)
+		if err == nil {
+			err = store.auditRSVP(tx, rsvp.eventID, rsvp.occurrence, rsvp.userID, "Waitlisted", "Going")
+		}
+		if err != nil {
+			return nil, err
+		}
 	}
-	return err
+
+	return promoted, tx.Commit()
 }
 
-// Get all RSVPs from the DB for the specified Event
-func RetrieveRSVPs(eventID string) ([]*RSVP, error) {
-	event, err := RetrieveEventByID(eventID)
+// Get all RSVPs from the DB for the specified Event, or occurrence of a recurring Event
+func (store *SQLEventStore) RetrieveRSVPs(eventID string, occurrence int64) ([]*RSVP, error) {
+	event, err := store.RetrieveEventByID(eventID)
 	if err != nil {
 		return nil, err
 	}
 
-	stmt, err := eventDB.Prepare(`SELECT * FROM rsvps WHERE event_id=?`)
+	return store.queryRSVPs(`SELECT `+rsvpColumns+` FROM rsvps WHERE event_id=? AND occurrence=? ORDER BY id`,
+		event.id, occurrence)
+}
+
+// Get the RSVPs to every occurrence of the specified Event
+func (store *SQLEventStore) RetrieveAllRSVPs(eventID string) ([]*RSVP, error) {
+	return store.queryRSVPs(`SELECT `+rsvpColumns+` FROM rsvps WHERE event_id=? ORDER BY id`, eventID)
+}
+
+// Get every RSVP where a user is going or might be going
+func (store *SQLEventStore) RetrieveUserRSVPs(userID string) ([]*RSVP, error) {
+	return store.queryRSVPs(`SELECT `+rsvpColumns+` FROM rsvps WHERE user_id=? AND status IN ('Going', 'Maybe')
+        ORDER BY id`, userID)
+}
+
+// Get all RSVPs returned by a query that selects rsvpColumns
+func (store *SQLEventStore) queryRSVPs(query string, args ...interface{}) ([]*RSVP, error) {
+	stmt, err := store.prepare(query)
 	PanicIf(err)
 
-	result, err := stmt.Query(event.id)
+	result, err := stmt.Query(args...)
+	if err != nil {
+		return nil, err
+	}
 
 	var rsvps []*RSVP
 
 	defer result.Close()
 	for result.Next() {
-		var rsvp RSVP
-		err := result.Scan(&rsvp.id, &rsvp.eventID, &rsvp.username, &rsvp.userID, &rsvp.status)
+		rsvp, err := scanRSVP(result)
 		if err != nil {
 			return nil, err
 		}
-		rsvps = append(rsvps, &rsvp)
+		rsvps = append(rsvps, rsvp)
 	}
 	err = result.Err()
 	if err != nil {
@@ -269,6 +849,77 @@ func RetrieveRSVPs(eventID string) ([]*RSVP, error) {
 	return rsvps, nil
 }
 
+// Scan the columns listed in rsvpColumns into a new RSVP
+func scanRSVP(row eventScanner) (*RSVP, error) {
+	var rsvp RSVP
+	err := row.Scan(&rsvp.id, &rsvp.eventID, &rsvp.occurrence, &rsvp.username, &rsvp.userID, &rsvp.status)
+	if err != nil {
+		return nil, err
+	}
+	return &rsvp, nil
+}
+
+// Get the set of Events and occurrences a user is going to or might be going to, keyed by occurrenceKey
+func retrieveRSVPedOccurrences(userID string) (map[string]bool, error) {
+	rsvps, err := eventStore.RetrieveUserRSVPs(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	rsvped := make(map[string]bool)
+	for _, rsvp := range rsvps {
+		rsvped[rsvp.eventID+"@"+strconv.FormatInt(rsvp.occurrence, 10)] = true
+	}
+	return rsvped, nil
+}
+
+func occurrenceKey(eventID int64, occurrence int64) string {
+	return strconv.FormatInt(eventID, 10) + "@" + strconv.FormatInt(occurrence, 10)
+}
+
+// Let everyone who is or might be going to an Event know about a change to it.  People who RSVPed to several
+// occurrences of a recurring Event only get the message once.
+func notifyRSVPs(s *discordgo.Session, rsvps []*RSVP, message string) {
+	notified := make(map[string]bool)
+	for _, rsvp := range rsvps {
+		if notified[rsvp.userID] {
+			continue
+		}
+		if strings.Compare(rsvp.status, "Going") == 0 || strings.Compare(rsvp.status, "Maybe") == 0 {
+			channel, channelErr := s.UserChannelCreate(rsvp.userID)
+			PanicIf(channelErr)
+			s.ChannelMessageSend(channel.ID, message)
+			notified[rsvp.userID] = true
+		}
+	}
+}
+
+// Parse the maximum number of attendees for an Event, where 0 or an empty value means no limit
+func parseMaxAttendees(input string) (int64, error) {
+	input = strings.TrimSpace(input)
+	if input == "" || strings.ToLower(input) == "none" {
+		return 0, nil
+	}
+	maxAttendees, err := strconv.ParseInt(input, 10, 64)
+	if err != nil || maxAttendees < 0 {
+		return 0, errors.New("The maximum number of attendees must be a whole number, or 0 for no limit.")
+	}
+	return maxAttendees, nil
+}
+
+// Let people who were moved off an Event's waitlist know that they have a spot now
+func notifyPromoted(s *discordgo.Session, event *Event, promoted []*RSVP) {
+	for _, rsvp := range promoted {
+		channel, channelErr := s.UserChannelCreate(rsvp.userID)
+		if channelErr != nil {
+			continue
+		}
+		s.ChannelMessageSend(channel.ID, "A spot opened up for **"+event.name+"** and you're now going!\n"+
+			"**When:** "+event.When()+"\n"+
+			"**Where:** "+event.location)
+	}
+}
+
 // Parse the command input from a Discord message and execute the command if valid
 func HandleCommandInput(s *discordgo.Session, msg *discordgo.MessageCreate) {
 	splitIn := strings.SplitN(msg.Content, " ", 2)
@@ -283,314 +934,134 @@ func HandleCommandInput(s *discordgo.Session, msg *discordgo.MessageCreate) {
 		cmdBody = splitCmd[1]
 	}
 
+	ctx := NewMessageContext(s, msg)
+
 	switch cmdKey {
 	case "create":
 		splitBody := strings.Split(cmdBody, "|")
-		if len(splitBody) != 5 {
-			s.ChannelMessageSend(msg.ChannelID, "Usage: !event create name|description|location|date|time")
+		if len(splitBody) != 5 && len(splitBody) != 6 {
+			ctx.reply("Usage: !event create name|description|location|date|time[|maxAttendees]")
 			return
 		}
-
-		name := splitBody[0]
-		description := splitBody[1]
-		location := splitBody[2]
-		date := splitBody[3]
-		time := splitBody[4]
-
-		event, err := CreateEvent(
-			name,
-			description,
-			location,
-			date,
-			time,
-			msg.Author.Username,
-			msg.Author.ID)
-
-		// Send a private message to the creator detailing the created Event
-		channel, channelErr := s.UserChannelCreate(msg.Author.ID)
-		PanicIf(channelErr)
-		if err == nil {
-			s.ChannelMessageSend(channel.ID,
-				"**Created event:** "+name+"\n"+
-					"**Description:** "+description+"\n"+
-					"**When:** "+event.date+" at "+event.time+"\n"+
-					"**Where:** "+location+"\n"+
-					"Your event ID is "+strconv.FormatInt(event.id, 10)+".\n"+
-					"Remember this ID if you wish to make changes to your event.")
-		} else {
-			s.ChannelMessageSend(channel.ID,
-				"Event creation failed.  Please make sure you are using the command correctly.")
+		max := ""
+		if len(splitBody) == 6 {
+			max = splitBody[5]
 		}
+		createEventCommand(ctx, splitBody[0], splitBody[1], splitBody[2], splitBody[3], splitBody[4], max)
 
 	case "info":
-		eventSearch := cmdBody
-		events, err := RetrieveEvent(eventSearch)
-		if err != nil {
-			s.ChannelMessageSend(msg.ChannelID, err.Error())
-			return
-		}
-
-		if len(events) > 1 {
-			// Matched multiple events, display each one with its ID so the user can pick one and retry their command
-			var buffer bytes.Buffer
-			for _, event := range events {
-				buffer.WriteString(
-					"ID: " + strconv.FormatInt(event.id, 10) + " `**" + event.name + "** on " + event.date +
-						" at " + event.time + "`\n")
-			}
-			s.ChannelMessageSend(msg.ChannelID, "Your query matched the following events:\n"+
-				buffer.String()+"Select one by its ID with !event info <ID> for more information.")
-
-		} else if len(events) == 1 {
-			event := events[0]
-			// Retrieve the RSVPs for this Event to display with the Event information
-			rsvps, err := RetrieveRSVPs(strconv.FormatInt(event.id, 10))
-			if err != nil {
-				s.ChannelMessageSend(msg.ChannelID, err.Error())
-				return
-			}
-			var buffer bytes.Buffer
-			for i, rsvp := range rsvps {
-				buffer.WriteString("__" + rsvp.username + "__: " + rsvp.status)
-				if i < (len(rsvps) - 1) {
-					buffer.WriteString("    ")
-				}
-			}
-			s.ChannelMessageSend(msg.ChannelID, event.String()+"\n"+buffer.String())
-		} else {
-			s.ChannelMessageSend(msg.ChannelID, "No events found.  Try a different search.")
-		}
+		eventSearch, occurrenceDate := splitOccurrenceSearch(cmdBody)
+		infoCommand(ctx, eventSearch, occurrenceDate)
 
 	case "cancel":
-		eventSearch := cmdBody
-		events, err := RetrieveEvent(eventSearch)
-		if err != nil {
-			s.ChannelMessageSend(msg.ChannelID, err.Error())
-			return
+		// Everything after the first | is the reason, which may itself contain |
+		splitBody := strings.SplitN(cmdBody, "|", 2)
+		reason := ""
+		if len(splitBody) == 2 {
+			reason = splitBody[1]
 		}
+		eventSearch, occurrenceDate := splitOccurrenceSearch(splitBody[0])
+		cancelCommand(ctx, eventSearch, occurrenceDate, reason)
 
-		if len(events) > 1 {
-			// Matched multiple events, display each one with its ID so the user can pick one and retry their command
-			var buffer bytes.Buffer
-			for _, event := range events {
-				buffer.WriteString(
-					"ID: " + strconv.FormatInt(event.id, 10) + " `**" + event.name + "** on " + event.date +
-						" at " + event.time + "`\n")
-			}
-			s.ChannelMessageSend(msg.ChannelID, "Your query matched the following events:\n"+
-				buffer.String()+"Select one by its ID with !event info <ID> for more information.")
-
-		} else if len(events) == 1 {
-			// Cancel the event
-			event := events[0]
-			if msg.Author.ID == event.creatorID {
-				defer CancelEvent(strconv.FormatInt(event.id, 10)) // defer because we want to let RSVPs know first
-				if err != nil {
-					s.ChannelMessageSend(msg.ChannelID, err.Error())
-				} else {
-					s.ChannelMessageSend(msg.ChannelID, "Event cancelled.")
-				}
-			} else {
-				s.ChannelMessageSend(msg.ChannelID, "You can't cancel an event you didn't create.")
-			}
-
-			// Let everyone who is or might be going to this Event know that it has been cancelled
-			rsvps, err := RetrieveRSVPs(strconv.FormatInt(event.id, 10))
-			if err != nil {
-				s.ChannelMessageSend(msg.ChannelID, err.Error())
-				return
-			}
-			for _, rsvp := range rsvps {
-				channel, channelErr := s.UserChannelCreate(rsvp.userID)
-				PanicIf(channelErr)
-				if err == nil {
-					if strings.Compare(rsvp.status, "Going") == 0 || strings.Compare(rsvp.status, "Maybe") == 0 {
-						s.ChannelMessageSend(channel.ID, "**"+event.name+"** has been cancelled.\n")
-					}
-				}
-			}
-		} else {
-			s.ChannelMessageSend(msg.ChannelID, "No events found.  Try a different search.")
-		}
+	case "restore":
+		restoreCommand(ctx, strings.TrimSpace(cmdBody))
 
+	case "history":
+		historyCommand(ctx, strings.TrimSpace(cmdBody))
 
 	case "edit":
+		// Several fields can be changed at once, e.g. "!event edit 12|name=Game night|time=8pm"
 		splitBody := strings.Split(cmdBody, "|")
-		if len(splitBody) != 3 {
-			s.ChannelMessageSend(msg.ChannelID, "Usage: !event edit eventID|fieldName|newValue\n"+
-				"Editable field names are desc[ription], loc[ation], date, and time.  Event name is not editable.")
+		edits, ok := ParseFieldEdits(splitBody[1:])
+		if !ok {
+			ctx.reply("Usage: !event edit eventID[@date]|field=value[|field=value...]\n" + editableFields)
 			return
 		}
+		eventSearch, occurrenceDate := splitOccurrenceSearch(splitBody[0])
+		editCommand(ctx, eventSearch, occurrenceDate, edits)
 
-		eventSearch := splitBody[0]
-		column := splitBody[1]
-		newValue := splitBody[2]
-
-		events, err := RetrieveEvent(eventSearch)
-		if err != nil {
-			s.ChannelMessageSend(msg.ChannelID, err.Error())
+	case "rsvp":
+		splitBody := strings.Split(cmdBody, "|")
+		if len(splitBody) != 2 {
+			ctx.reply("Usage: !event rsvp eventID[@date]|choice")
 			return
 		}
+		eventSearch, occurrenceDate := splitOccurrenceSearch(splitBody[0])
+		rsvpCommand(ctx, eventSearch, occurrenceDate, splitBody[1])
 
-		if len(events) > 1 {
-			// Matched multiple events, display each one with its ID so the user can pick one and retry their command
-			var buffer bytes.Buffer
-			for _, event := range events {
-				buffer.WriteString(
-					"ID: " + strconv.FormatInt(event.id, 10) + " `**" + event.name + "** on " + event.date +
-						" at " + event.time + "`\n")
-			}
-			s.ChannelMessageSend(msg.ChannelID, "Your query matched the following events:\n"+
-				buffer.String()+"Select one by its ID with !event info <ID> for more information.")
-
-		} else if len(events) == 1 {
-			// Update the Event with the new information
-			event := events[0]
+	case "ics", "ical":
+		icsCommand(ctx, strings.TrimSpace(cmdBody))
 
-			if event.creatorID != msg.Author.ID {
-				s.ChannelMessageSend(msg.ChannelID, "You can't edit an event you didn't create.")
-				return
-			}
-
-			idStr := strconv.FormatInt(event.id, 10)
-
-			var msgBuffer bytes.Buffer
-			msgBuffer.WriteString("**" + event.name + "** has been updated.\n")
-
-			var err error
-			switch strings.ToLower(column) {
-			case "description", "desc":
-				err = UpdateEventDescription(idStr, newValue)
-				msgBuffer.WriteString("New description: " + newValue)
-			case "description+", "desc+": // for appending to the description instead of overwriting it
-				err = UpdateEventDescription(idStr, event.description+"\n*Update:* "+newValue)
-				msgBuffer.WriteString("Update: " + newValue)
-			case "location", "loc":
-				err = UpdateEventLocation(idStr, newValue)
-				msgBuffer.WriteString("New location: " + newValue)
-			case "date":
-				err = UpdateEventDate(idStr, newValue)
-				msgBuffer.WriteString("New date: " + newValue)
-			case "time":
-				err = UpdateEventTime(idStr, newValue)
-				msgBuffer.WriteString("New time: " + newValue)
+	case "import":
+		if len(msg.Attachments) != 1 {
+			importCommand(ctx, nil)
+			return
+		}
+		importCommand(ctx, msg.Attachments[0])
+
+	case "list", "ls":
+		// Any combination of filters and a page number, e.g. "!event list mine past 2"
+		filter := EventFilter{guildID: msg.GuildID}
+		page := 1
+		for _, arg := range strings.Fields(strings.ToLower(cmdBody)) {
+			switch arg {
+			case "upcoming":
+				filter.past = false
+			case "past":
+				filter.past = true
+			case "mine":
+				filter.creatorID = msg.Author.ID
+			case "rsvp", "rsvped", "going":
+				filter.rsvpUserID = msg.Author.ID
 			default:
-				s.ChannelMessageSend(msg.ChannelID,
-					"Editable field names are desc[ription], loc[ation], date, and time.  Event name is not editable.")
-				return
-			}
-
-
-			// Send a private message to the creator/editor with the status of the update
-			channel, channelErr := s.UserChannelCreate(msg.Author.ID)
-			PanicIf(channelErr)
-			if err == nil {
-				s.ChannelMessageSend(channel.ID, event.name+" updated successfully.")
-			} else {
-				s.ChannelMessageSend(channel.ID, "There was a problem updating "+event.name+
-					".  Please make sure you are using the command correctly.")
-			}
-
-
-			// Let everyone who is or might be going to this Event know it has been updated
-			rsvps, err := RetrieveRSVPs(strconv.FormatInt(event.id, 10))
-			if err != nil {
-				s.ChannelMessageSend(msg.ChannelID, err.Error())
-				return
-			}
-			for _, rsvp := range rsvps {
-				channel, channelErr := s.UserChannelCreate(rsvp.userID)
-				PanicIf(channelErr)
-				if err == nil {
-					if strings.Compare(rsvp.status, "Going") == 0 || strings.Compare(rsvp.status, "Maybe") == 0 {
-						s.ChannelMessageSend(channel.ID, msgBuffer.String())
-					}
+				n, err := strconv.Atoi(arg)
+				if err != nil || n < 1 {
+					ctx.reply("Usage: !event list [upcoming|past] [mine] [rsvp] [page]")
+					return
 				}
+				page = n
 			}
-
-		} else {
-			s.ChannelMessageSend(msg.ChannelID, "No events found.  Try a different search.")
 		}
+		listCommand(ctx, filter, page)
 
-	case "rsvp":
-		splitBody := strings.Split(cmdBody, "|")
-		if len(splitBody) != 2 {
-			s.ChannelMessageSend(msg.ChannelID, "Usage: !event rsvp eventID|choice")
-			return
-		}
-
-		choice := splitBody[1]
-		// Validate RSVP choice
-		switch strings.ToLower(choice) {
-		case "g", "going":
-			choice = "Going"
+	case "timezone", "tz":
+		timezoneCommand(ctx, strings.TrimSpace(cmdBody))
 
-		case "m", "maybe":
-			choice = "Maybe"
+	case "channel":
+		channelCommand(ctx, strings.TrimSpace(cmdBody))
 
-		case "n", "not going":
-			choice = "Not going"
+	case "feed":
+		feedCommand(ctx, cmdBody)
 
-		default:
-			s.ChannelMessageSend(msg.ChannelID,
-				"Valid RSVP choices: G[oing], M[aybe], N[ot going]")
+	case "cohost":
+		// e.g. "!event cohost add 12|@user"
+		splitAction := strings.SplitN(strings.TrimSpace(cmdBody), " ", 2)
+		if len(splitAction) != 2 || len(strings.Split(splitAction[1], "|")) != 2 {
+			ctx.reply("Usage: !event cohost add|remove eventID|@user")
 			return
 		}
+		splitBody := strings.Split(splitAction[1], "|")
+		cohostCommand(ctx, splitAction[0], strings.TrimSpace(splitBody[0]), splitBody[1])
 
-		eventSearch := splitBody[0]
-		events, err := RetrieveEvent(eventSearch)
-		if err != nil {
-			s.ChannelMessageSend(msg.ChannelID, err.Error())
+	case "transfer":
+		splitBody := strings.Split(cmdBody, "|")
+		if len(splitBody) != 2 {
+			ctx.reply("Usage: !event transfer eventID|@user")
 			return
 		}
-
-		if len(events) > 1 {
-			// Matched multiple events, display each one with its ID so the user can pick one and retry their command
-			var buffer bytes.Buffer
-			for _, event := range events {
-				buffer.WriteString(
-					"ID: " + strconv.FormatInt(event.id, 10) + " `**" + event.name + "** on " + event.date +
-						" at " + event.time + "`\n")
-			}
-			s.ChannelMessageSend(msg.ChannelID, "Your query matched the following events:\n"+
-				buffer.String()+"Select one by its ID with !event info <ID> for more information.")
-
-		} else if len(events) == 1 {
-			// Update the RSVP if it already exists
-			event := events[0]
-			rsvps, err := RetrieveRSVPs(strconv.FormatInt(event.id, 10))
-			for _, rsvp := range rsvps {
-				if rsvp.userID == msg.Author.ID {
-					UpdateRSVP(strconv.FormatInt(rsvp.id, 10), choice)
-					return
-				}
-			}
-
-			// Create a RSVP because one didn't exist already
-			rsvp, err := CreateRSVP(strconv.FormatInt(event.id, 10), msg.Author.Username, msg.Author.ID, choice)
-
-			channel, channelErr := s.UserChannelCreate(msg.Author.ID)
-			PanicIf(channelErr)
-			if err == nil {
-				s.ChannelMessageSend(channel.ID, "RSVP submitted - "+event.name+": "+rsvp.status)
-			} else {
-				s.ChannelMessageSend(msg.ChannelID,
-					"Submit RSVP failed.  Please make sure you are using the command correctly")
-				return
-			}
-
+		transferCommand(ctx, strings.TrimSpace(splitBody[0]), splitBody[1])
+
+	case "managers":
+		args := strings.Fields(cmdBody)
+		if len(args) == 0 {
+			managersCommand(ctx, "", "")
+		} else if len(args) == 2 {
+			managersCommand(ctx, args[0], args[1])
 		} else {
-			s.ChannelMessageSend(msg.ChannelID, "No events found.  Try a different search.")
+			ctx.reply("Usage: !event managers [add|remove @role]")
 		}
 
 	case "help":
-		s.ChannelMessageSend(msg.ChannelID,
-			"__Discord Event Planner created by Mongoose__"+"\n```"+
-				"**Create event:** !event create name|description|location|date|time"+"\n"+
-				"**Edit event:**   !event edit eventID|fieldName|newValue"+"\n"+
-				"**Cancel event**  !event cancel eventID"+"\n"+
-				"**Show event**    !event info eventID  OR  !event info eventName"+"\n"+
-				"**RSVP**          !event rsvp eventID|choice OR  !rsvp eventName|choice"+"\n"+
-				"**RSVP choices:** G[oing], M[aybe], N[ot going]"+"```")
+		helpCommand(ctx)
 	}
 }
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	DEFAULT_TIMEZONE string = "UTC"
+
+	clockPattern   = regexp.MustCompile(`^(\d{1,2})(?::(\d{2}))?\s*(am|pm)?$`)
+	trailingClock  = regexp.MustCompile(`(?:^|\s)(?:at\s+)?(\d{1,2}(?::\d{2})?\s*(?:am|pm)|\d{1,2}:\d{2}|noon|midnight)$`)
+	ordinalPattern = regexp.MustCompile(`(\d+)(st|nd|rd|th)\b`)
+
+	// Layouts for dates that include the year
+	datedLayouts = []string{
+		"2006-01-02", "2006/01/02", "1/2/2006", "1/2/06",
+		"Jan 2 2006", "January 2 2006", "2 Jan 2006", "2 January 2006",
+	}
+
+	// Layouts for dates without a year, which are assumed to be the next such date
+	yearlessLayouts = []string{
+		"1/2", "Jan 2", "January 2", "2 Jan", "2 January",
+	}
+
+	// Layouts for full ISO timestamps which carry both a date and a time
+	timestampLayouts = []string{
+		"2006-01-02T15:04", "2006-01-02T15:04:05", "2006-01-02 15:04", "2006-01-02 15:04:05",
+	}
+
+	weekdays = map[string]time.Weekday{
+		"sun": time.Sunday, "sunday": time.Sunday,
+		"mon": time.Monday, "monday": time.Monday,
+		"tue": time.Tuesday, "tues": time.Tuesday, "tuesday": time.Tuesday,
+		"wed": time.Wednesday, "wednesday": time.Wednesday,
+		"thu": time.Thursday, "thur": time.Thursday, "thurs": time.Thursday, "thursday": time.Thursday,
+		"fri": time.Friday, "friday": time.Friday,
+		"sat": time.Saturday, "saturday": time.Saturday,
+	}
+)
+
+const (
+	// Layout used when displaying an Event's time to users
+	eventTimeLayout = "Monday, January 2, 2006 at 3:04 PM MST"
+
+	dateHelp = "Try something like 2026-10-21, Oct 21, 10/21, tomorrow or next friday."
+	timeHelp = "Try something like 7pm, 7:30 pm or 19:30."
+)
+
+// Parse a date and time typed by a user, such as "tomorrow 7pm" or "Oct 21 19:30", into an absolute time.
+// Dates and times without an explicit offset are interpreted in loc, relative to now.
+func ParseEventDateTime(input string, loc *time.Location, now time.Time) (time.Time, error) {
+	input = normalizeTimeInput(input)
+	if input == "" {
+		return time.Time{}, errors.New("Please give a date and time for the event.  " + dateHelp)
+	}
+
+	iso := strings.ToUpper(input)
+	if t, err := time.Parse(time.RFC3339, iso); err == nil {
+		return t.UTC(), nil
+	}
+	for _, layout := range timestampLayouts {
+		if t, err := time.ParseInLocation(layout, iso, loc); err == nil {
+			return t.UTC(), nil
+		}
+	}
+
+	match := trailingClock.FindStringSubmatchIndex(input)
+	if match == nil {
+		return time.Time{}, errors.New("I couldn't find a time in \"" + input + "\".  " + timeHelp)
+	}
+	hour, minute, err := ParseEventClock(input[match[2]:match[3]])
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	datePart := strings.TrimSpace(input[:match[0]])
+	day := now.In(loc)
+	if datePart != "" {
+		day, err = ParseEventDate(datePart, loc, now)
+		if err != nil {
+			return time.Time{}, err
+		}
+	}
+
+	return time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, loc).UTC(), nil
+}
+
+// Parse a date typed by a user and return midnight of that day in loc.
+// Relative dates like "tomorrow" and "next friday" are resolved against now.
+func ParseEventDate(input string, loc *time.Location, now time.Time) (time.Time, error) {
+	input = normalizeTimeInput(input)
+	today := now.In(loc)
+	today = time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, loc)
+
+	switch input {
+	case "today", "tonight":
+		return today, nil
+	case "tomorrow":
+		return today.AddDate(0, 0, 1), nil
+	}
+
+	fields := strings.Fields(input)
+	if len(fields) == 0 {
+		return time.Time{}, errors.New("Please give a date for the event.  " + dateHelp)
+	}
+	if len(fields) <= 2 {
+		name := fields[len(fields)-1]
+		if weekday, ok := weekdays[name]; ok {
+			days := (int(weekday) - int(today.Weekday()) + 7) % 7
+			if len(fields) == 2 {
+				switch fields[0] {
+				case "this":
+				case "next":
+					if days == 0 {
+						days = 7
+					}
+				default:
+					return time.Time{}, errors.New("I couldn't understand the date \"" + input + "\".  " + dateHelp)
+				}
+			}
+			return today.AddDate(0, 0, days), nil
+		}
+	}
+
+	cleaned := ordinalPattern.ReplaceAllString(strings.Replace(input, ",", "", -1), "$1")
+	for _, layout := range datedLayouts {
+		if t, err := time.ParseInLocation(layout, cleaned, loc); err == nil {
+			return t, nil
+		}
+	}
+	for _, layout := range yearlessLayouts {
+		if t, err := time.ParseInLocation(layout, cleaned, loc); err == nil {
+			t = time.Date(today.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+			if t.Before(today) {
+				t = t.AddDate(1, 0, 0)
+			}
+			return t, nil
+		}
+	}
+
+	return time.Time{}, errors.New("I couldn't understand the date \"" + input + "\".  " + dateHelp)
+}
+
+// Parse a time of day typed by a user, such as "7pm", "7:30 pm", "19:30" or "noon"
+func ParseEventClock(input string) (hour int, minute int, err error) {
+	input = normalizeTimeInput(input)
+	switch input {
+	case "noon":
+		return 12, 0, nil
+	case "midnight":
+		return 0, 0, nil
+	}
+
+	match := clockPattern.FindStringSubmatch(input)
+	if match == nil {
+		return 0, 0, errors.New("I couldn't understand the time \"" + input + "\".  " + timeHelp)
+	}
+
+	hour, _ = strconv.Atoi(match[1])
+	if match[2] != "" {
+		minute, _ = strconv.Atoi(match[2])
+	}
+	switch match[3] {
+	case "am":
+		if hour < 1 || hour > 12 {
+			return 0, 0, errors.New("\"" + input + "\" is not a valid time.  " + timeHelp)
+		}
+		hour = hour % 12
+	case "pm":
+		if hour < 1 || hour > 12 {
+			return 0, 0, errors.New("\"" + input + "\" is not a valid time.  " + timeHelp)
+		}
+		hour = hour%12 + 12
+	default:
+		if match[2] == "" {
+			// A bare number like "7" is too ambiguous to guess at
+			return 0, 0, errors.New("Please add am/pm or minutes to \"" + input + "\".  " + timeHelp)
+		}
+	}
+	if hour > 23 || minute > 59 {
+		return 0, 0, errors.New("\"" + input + "\" is not a valid time.  " + timeHelp)
+	}
+
+	return hour, minute, nil
+}
+
+// Load a timezone by its IANA name, falling back to the default timezone if it is empty or unknown
+func LoadTimezone(name string) *time.Location {
+	if name == "" {
+		name = DEFAULT_TIMEZONE
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// Lowercase the input, collapse whitespace and drop the dots from "p.m." so the parsers see one canonical form
+func normalizeTimeInput(input string) string {
+	input = strings.ToLower(strings.Join(strings.Fields(input), " "))
+	input = strings.Replace(input, "a.m.", "am", -1)
+	input = strings.Replace(input, "p.m.", "pm", -1)
+	return input
+}
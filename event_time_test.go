@@ -0,0 +1,105 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseEventDateTime(t *testing.T) {
+	newYork, _ := time.LoadLocation("America/New_York")
+	tokyo, _ := time.LoadLocation("Asia/Tokyo")
+	now := time.Date(2026, time.October, 18, 12, 0, 0, 0, newYork) // a Sunday, during daylight saving time
+
+	cases := []struct {
+		input   string
+		loc     *time.Location
+		want    time.Time // in UTC, or zero if the input should be rejected
+		wantErr bool
+	}{
+		{"tomorrow 7pm", newYork, time.Date(2026, 10, 19, 23, 0, 0, 0, time.UTC), false},
+		{"Oct 21 19:30", newYork, time.Date(2026, 10, 21, 23, 30, 0, 0, time.UTC), false},
+		{"next friday 7:30 p.m.", newYork, time.Date(2026, 10, 23, 23, 30, 0, 0, time.UTC), false},
+		{"friday noon", newYork, time.Date(2026, 10, 23, 16, 0, 0, 0, time.UTC), false},
+		{"sunday 9pm", newYork, time.Date(2026, 10, 19, 1, 0, 0, 0, time.UTC), false},
+		{"next sunday 9pm", newYork, time.Date(2026, 10, 26, 1, 0, 0, 0, time.UTC), false},
+		{"7pm", newYork, time.Date(2026, 10, 18, 23, 0, 0, 0, time.UTC), false},
+		{"21st October at 8am", newYork, time.Date(2026, 10, 21, 12, 0, 0, 0, time.UTC), false},
+		{"Oct 21, 2027 10am", newYork, time.Date(2027, 10, 21, 14, 0, 0, 0, time.UTC), false},
+		{"2026-10-21 19:00", newYork, time.Date(2026, 10, 21, 23, 0, 0, 0, time.UTC), false},
+		{"2026-10-21 19:00", tokyo, time.Date(2026, 10, 21, 10, 0, 0, 0, time.UTC), false},
+		{"2026-10-21T19:00:00Z", tokyo, time.Date(2026, 10, 21, 19, 0, 0, 0, time.UTC), false},
+
+		// Standard time starts on Nov 1, so the offset from UTC changes
+		{"Nov 2 9am", newYork, time.Date(2026, 11, 2, 14, 0, 0, 0, time.UTC), false},
+		// Dates without a year that have already gone by this year are next year's
+		{"Jan 3 6pm", newYork, time.Date(2027, 1, 3, 23, 0, 0, 0, time.UTC), false},
+
+		{"", newYork, time.Time{}, true},
+		{"tomorrow", newYork, time.Time{}, true},
+		{"tomorrow 7", newYork, time.Time{}, true},
+		{"tomorrow 13pm", newYork, time.Time{}, true},
+		{"someday 7pm", newYork, time.Time{}, true},
+		{"last friday 7pm", newYork, time.Time{}, true},
+	}
+
+	for _, c := range cases {
+		got, err := ParseEventDateTime(c.input, c.loc, now)
+		if (err != nil) != c.wantErr {
+			t.Fatalf("%q in %s: got error %v, want error %v", c.input, c.loc, err, c.wantErr)
+		}
+		if !got.Equal(c.want) {
+			t.Fatalf("%q in %s: got %v, want %v", c.input, c.loc, got, c.want)
+		}
+	}
+}
+
+func TestParseEventClock(t *testing.T) {
+	cases := []struct {
+		input      string
+		wantHour   int
+		wantMinute int
+		wantErr    bool
+	}{
+		{"7pm", 19, 0, false},
+		{"7:30 am", 7, 30, false},
+		{"7:30 A.M.", 7, 30, false},
+		{"12am", 0, 0, false},
+		{"12pm", 12, 0, false},
+		{"noon", 12, 0, false},
+		{"midnight", 0, 0, false},
+		{"19:30", 19, 30, false},
+		{"7", 0, 0, true},
+		{"0pm", 0, 0, true},
+		{"13pm", 0, 0, true},
+		{"25:00", 0, 0, true},
+		{"7:60", 0, 0, true},
+		{"seven", 0, 0, true},
+	}
+
+	for _, c := range cases {
+		hour, minute, err := ParseEventClock(c.input)
+		if (err != nil) != c.wantErr {
+			t.Fatalf("%q: got error %v, want error %v", c.input, err, c.wantErr)
+		}
+		if hour != c.wantHour || minute != c.wantMinute {
+			t.Fatalf("%q: got %d:%02d, want %d:%02d", c.input, hour, minute, c.wantHour, c.wantMinute)
+		}
+	}
+}
+
+func TestLoadTimezone(t *testing.T) {
+	cases := []struct {
+		name string
+		want string
+	}{
+		{"America/Chicago", "America/Chicago"},
+		{"", DEFAULT_TIMEZONE},
+		{"Mars/Olympus_Mons", "UTC"},
+	}
+
+	for _, c := range cases {
+		if got := LoadTimezone(c.name).String(); got != c.want {
+			t.Fatalf("%q: got %s, want %s", c.name, got, c.want)
+		}
+	}
+}
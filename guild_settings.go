@@ -0,0 +1,160 @@
+package main
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// Get the timezone events in a guild are created in, or the default timezone if the guild hasn't set one
+func RetrieveGuildTimezone(guildID string) (*time.Location, error) {
+	name, err := eventStore.RetrieveGuildSetting(guildID, "timezone")
+	if err != nil {
+		return nil, err
+	}
+	return LoadTimezone(name), nil
+}
+
+// Set the timezone events in a guild are created in
+func UpdateGuildTimezone(guildID string, timezone string) error {
+	return eventStore.UpdateGuildSetting(guildID, "timezone", timezone)
+}
+
+// Get the channel new events in a guild are announced in, or an empty string if they aren't announced
+func RetrieveGuildAnnounceChannel(guildID string) (string, error) {
+	return eventStore.RetrieveGuildSetting(guildID, "announce_channel_id")
+}
+
+// Set the channel new events in a guild are announced in, or stop announcing them if channelID is empty
+func UpdateGuildAnnounceChannel(guildID string, channelID string) error {
+	return eventStore.UpdateGuildSetting(guildID, "announce_channel_id", channelID)
+}
+
+// Get the token that has to be in the link to a guild's calendar feed, or an empty string if the feed is off
+func RetrieveCalendarToken(guildID string) (string, error) {
+	return eventStore.RetrieveGuildSetting(guildID, "calendar_token")
+}
+
+// Set the token that has to be in the link to a guild's calendar feed, or turn the feed off if token is empty
+func UpdateCalendarToken(guildID string, token string) error {
+	return eventStore.UpdateGuildSetting(guildID, "calendar_token", token)
+}
+
+// Get the roles whose members can manage every Event in a guild
+func RetrieveGuildManagerRoles(guildID string) ([]string, error) {
+	roles, err := eventStore.RetrieveGuildSetting(guildID, "event_manager_roles")
+	if err != nil {
+		return nil, err
+	}
+	return splitSetting(roles), nil
+}
+
+// Set the roles whose members can manage every Event in a guild
+func UpdateGuildManagerRoles(guildID string, roles []string) error {
+	return eventStore.UpdateGuildSetting(guildID, "event_manager_roles", strings.Join(roles, ","))
+}
+
+// What the repost detector leaves alone in a guild
+type RepostSettings struct {
+	ignoredChannels []string      // channels nothing is checked or recorded in
+	exemptRoles     []string      // roles whose members can post anything
+	allowedDomains  []string      // sites whose links can be posted any number of times
+	window          time.Duration // how long until something can be posted again, or 0 for never
+}
+
+// Get what the repost detector leaves alone in a guild
+func RetrieveRepostSettings(guildID string) (*RepostSettings, error) {
+	var settings RepostSettings
+	lists := map[string]*[]string{
+		"repost_ignored_channels": &settings.ignoredChannels,
+		"repost_exempt_roles":     &settings.exemptRoles,
+		"repost_allowed_domains":  &settings.allowedDomains,
+	}
+	for columnName, list := range lists {
+		value, err := eventStore.RetrieveGuildSetting(guildID, columnName)
+		if err != nil {
+			return nil, err
+		}
+		*list = splitSetting(value)
+	}
+
+	window, err := eventStore.RetrieveGuildSetting(guildID, "repost_window")
+	if err != nil {
+		return nil, err
+	}
+	if window != "" {
+		settings.window, err = time.ParseDuration(window)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &settings, nil
+}
+
+// Set one of the lists of channels, roles or domains the repost detector leaves alone in a guild
+func UpdateRepostList(guildID string, columnName string, list []string) error {
+	return eventStore.UpdateGuildSetting(guildID, columnName, strings.Join(list, ","))
+}
+
+// Set how long until something can be posted again in a guild without it being a repost, or 0 for never
+func UpdateRepostWindow(guildID string, window time.Duration) error {
+	value := ""
+	if window > 0 {
+		value = window.String()
+	}
+	return eventStore.UpdateGuildSetting(guildID, "repost_window", value)
+}
+
+// Split a comma separated setting into its values
+func splitSetting(value string) []string {
+	var values []string
+	for _, field := range strings.Split(value, ",") {
+		if field != "" {
+			values = append(values, field)
+		}
+	}
+	return values
+}
+
+// Get a guild's setting from the DB, or an empty string if the guild hasn't set it
+func (store *SQLEventStore) RetrieveGuildSetting(guildID string, columnName string) (string, error) {
+	stmt, err := store.prepare(`SELECT ` + columnName + ` FROM guild_settings WHERE guild_id=?`)
+	if err != nil {
+		return "", err
+	}
+
+	var value string
+	err = stmt.QueryRow(guildID).Scan(&value)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return value, nil
+}
+
+// Set one of a guild's settings in the DB, leaving the rest of them unchanged
+func (store *SQLEventStore) UpdateGuildSetting(guildID string, columnName string, value string) error {
+	stmt, err := store.prepare(
+		`INSERT INTO guild_settings (guild_id, ` + columnName + `) VALUES (?, ?)
+        ON CONFLICT (guild_id) DO UPDATE SET ` + columnName + `=excluded.` + columnName)
+	if err != nil {
+		return err
+	}
+
+	tx, err := store.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Stmt(stmt).Exec(guildID, value)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	tx.Commit()
+	return nil
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	icsProductID = "-//Mongoose//Discord Event Planner//EN"
+
+	icsUTCLayout   = "20060102T150405Z"
+	icsLocalLayout = "20060102T150405"
+
+	// Events don't record when they end, so calendars are told they last this long
+	defaultEventDuration = "PT1H"
+
+	// iCalendar lines longer than this many bytes have to be folded onto continuation lines
+	icsLineLength = 75
+
+	// How many random bytes are in the token that has to be in a guild's calendar feed link
+	calendarTokenBytes = 16
+)
+
+var (
+	// Where the calendar feed can be reached, e.g. https://events.example.com, or empty if it isn't served
+	CALENDAR_URL string
+)
+
+// Build an iCalendar file containing a single Event.  A recurring Event is exported as a whole series.
+func EventICS(event *Event, now time.Time) (string, error) {
+	return CalendarICS([]*Event{event.seriesEvent()}, "", now)
+}
+
+// Build an iCalendar file containing several Events, with name as the calendar's display name if it isn't empty
+func CalendarICS(events []*Event, name string, now time.Time) (string, error) {
+	var buffer bytes.Buffer
+	writeICSLine(&buffer, "BEGIN", "VCALENDAR")
+	writeICSLine(&buffer, "VERSION", "2.0")
+	writeICSLine(&buffer, "PRODID", icsProductID)
+	writeICSLine(&buffer, "CALSCALE", "GREGORIAN")
+	writeICSLine(&buffer, "METHOD", "PUBLISH")
+	if name != "" {
+		writeICSLine(&buffer, "X-WR-CALNAME", escapeICSText(name))
+	}
+
+	// Recurring Events are written in their own timezone so they keep their time of day across DST changes,
+	// which needs a VTIMEZONE for each timezone used
+	timezones := make(map[string]int)
+	for _, event := range events {
+		if event.recurrence == nil {
+			continue
+		}
+		year := event.LocalTime().Year()
+		if first, ok := timezones[event.timezone]; !ok || year < first {
+			timezones[event.timezone] = year
+		}
+	}
+	var names []string
+	for timezone := range timezones {
+		names = append(names, timezone)
+	}
+	sort.Strings(names)
+	for _, timezone := range names {
+		writeVTimezone(&buffer, LoadTimezone(timezone), timezones[timezone])
+	}
+
+	for _, event := range events {
+		err := writeVEvent(&buffer, event, now)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	writeICSLine(&buffer, "END", "VCALENDAR")
+	return buffer.String(), nil
+}
+
+// Write an Event as a VEVENT.  A recurring Event also gets an EXDATE for each cancelled occurrence and a VEVENT for
+// each changed one.
+func writeVEvent(buffer *bytes.Buffer, event *Event, now time.Time) error {
+	uid := strconv.FormatInt(event.id, 10) + "@discord-event-planner"
+	var loc *time.Location
+	if event.recurrence != nil {
+		loc = LoadTimezone(event.timezone)
+	}
+
+	writeICSLine(buffer, "BEGIN", "VEVENT")
+	writeICSLine(buffer, "UID", uid)
+	writeICSLine(buffer, "DTSTAMP", now.UTC().Format(icsUTCLayout))
+	writeICSTime(buffer, "DTSTART", event.startsAt, loc)
+	writeICSLine(buffer, "DURATION", defaultEventDuration)
+	writeEventDetails(buffer, event)
+
+	var exceptions []*EventException
+	if event.recurrence != nil {
+		writeICSLine(buffer, "RRULE", event.recurrence.String())
+
+		byOccurrence, err := eventStore.RetrieveEventExceptions(event.id)
+		if err != nil {
+			return err
+		}
+		for _, exception := range byOccurrence {
+			exceptions = append(exceptions, exception)
+		}
+		sort.Slice(exceptions, func(i, j int) bool {
+			return exceptions[i].occurrence < exceptions[j].occurrence
+		})
+		for _, exception := range exceptions {
+			if exception.cancelled {
+				writeICSTime(buffer, "EXDATE", time.Unix(exception.occurrence, 0), loc)
+			}
+		}
+	}
+	writeICSLine(buffer, "END", "VEVENT")
+
+	for _, exception := range exceptions {
+		if exception.cancelled {
+			continue
+		}
+		occurrence, err := RetrieveOccurrence(event, exception.occurrence)
+		if err != nil {
+			continue
+		}
+
+		writeICSLine(buffer, "BEGIN", "VEVENT")
+		writeICSLine(buffer, "UID", uid)
+		writeICSLine(buffer, "DTSTAMP", now.UTC().Format(icsUTCLayout))
+		writeICSTime(buffer, "RECURRENCE-ID", time.Unix(exception.occurrence, 0), loc)
+		writeICSTime(buffer, "DTSTART", occurrence.startsAt, loc)
+		writeICSLine(buffer, "DURATION", defaultEventDuration)
+		writeEventDetails(buffer, occurrence)
+		writeICSLine(buffer, "END", "VEVENT")
+	}
+
+	return nil
+}
+
+// Write the descriptive properties shared by an Event and its changed occurrences
+func writeEventDetails(buffer *bytes.Buffer, event *Event) {
+	writeICSLine(buffer, "SUMMARY", escapeICSText(event.name))
+	if event.location != "" {
+		writeICSLine(buffer, "LOCATION", escapeICSText(event.location))
+	}
+	description := event.description
+	if description != "" {
+		description += "\n\n"
+	}
+	description += "Created by " + event.creator + ".  Event ID " + strconv.FormatInt(event.id, 10) + "."
+	writeICSLine(buffer, "DESCRIPTION", escapeICSText(description))
+
+	// Calendars that already have a cancelled Event take it off their schedule instead of keeping it
+	if event.status == EventCancelled {
+		writeICSLine(buffer, "STATUS", "CANCELLED")
+	} else {
+		writeICSLine(buffer, "STATUS", "CONFIRMED")
+	}
+}
+
+// Write a DATE-TIME property in loc's local time, or in UTC if loc is nil or UTC
+func writeICSTime(buffer *bytes.Buffer, name string, t time.Time, loc *time.Location) {
+	if loc == nil || loc == time.UTC {
+		writeICSLine(buffer, name, t.UTC().Format(icsUTCLayout))
+		return
+	}
+	writeICSLine(buffer, name+";TZID="+loc.String(), t.In(loc).Format(icsLocalLayout))
+}
+
+// Write a VTIMEZONE for loc, describing its DST changes with the rules in effect during year
+// Go doesn't expose a timezone's rules, so they are worked out from the times the UTC offset changes during the year
+func writeVTimezone(buffer *bytes.Buffer, loc *time.Location, year int) {
+	if loc == time.UTC {
+		return
+	}
+
+	type transition struct {
+		at         time.Time // local time just before the change
+		name       string
+		fromOffset int
+		toOffset   int
+	}
+	var transitions []transition
+
+	t := time.Date(year, time.January, 1, 0, 0, 0, 0, loc)
+	end := t.AddDate(1, 0, 0)
+	_, offset := t.Zone()
+	for ; t.Before(end); t = t.Add(15 * time.Minute) {
+		name, newOffset := t.Zone()
+		if newOffset != offset {
+			transitions = append(transitions, transition{
+				at:         t.UTC().Add(time.Duration(offset) * time.Second),
+				name:       name,
+				fromOffset: offset,
+				toOffset:   newOffset,
+			})
+			offset = newOffset
+		}
+	}
+
+	writeICSLine(buffer, "BEGIN", "VTIMEZONE")
+	writeICSLine(buffer, "TZID", loc.String())
+	if len(transitions) == 0 {
+		name, offset := time.Date(year, time.January, 1, 0, 0, 0, 0, loc).Zone()
+		writeICSLine(buffer, "BEGIN", "STANDARD")
+		writeICSLine(buffer, "DTSTART", "19700101T000000")
+		writeICSLine(buffer, "TZOFFSETFROM", formatICSOffset(offset))
+		writeICSLine(buffer, "TZOFFSETTO", formatICSOffset(offset))
+		writeICSLine(buffer, "TZNAME", name)
+		writeICSLine(buffer, "END", "STANDARD")
+	}
+	for _, change := range transitions {
+		component := "STANDARD"
+		if change.toOffset > change.fromOffset {
+			component = "DAYLIGHT"
+		}
+
+		// Repeat the change every year on the same weekday of the month, e.g. the 2nd Sunday of March
+		week := (change.at.Day()-1)/7 + 1
+		if change.at.Day()+7 > daysIn(change.at.Year(), change.at.Month(), time.UTC) {
+			week = -1
+		}
+
+		writeICSLine(buffer, "BEGIN", component)
+		writeICSLine(buffer, "DTSTART", change.at.Format(icsLocalLayout))
+		writeICSLine(buffer, "TZOFFSETFROM", formatICSOffset(change.fromOffset))
+		writeICSLine(buffer, "TZOFFSETTO", formatICSOffset(change.toOffset))
+		writeICSLine(buffer, "TZNAME", change.name)
+		writeICSLine(buffer, "RRULE", "FREQ=YEARLY;BYMONTH="+strconv.Itoa(int(change.at.Month()))+
+			";BYDAY="+strconv.Itoa(week)+rruleDays[change.at.Weekday()])
+		writeICSLine(buffer, "END", component)
+	}
+	writeICSLine(buffer, "END", "VTIMEZONE")
+}
+
+// Format a UTC offset in seconds as an iCalendar UTC-OFFSET such as -0500 or +0530
+func formatICSOffset(offset int) string {
+	sign := "+"
+	if offset < 0 {
+		sign = "-"
+		offset = -offset
+	}
+	return fmt.Sprintf("%s%02d%02d", sign, offset/3600, offset%3600/60)
+}
+
+// Write a content line, folding it so no line is longer than icsLineLength bytes
+// Lines are only broken between UTF-8 characters, never inside one
+func writeICSLine(buffer *bytes.Buffer, name string, value string) {
+	line := name + ":" + value
+	limit := icsLineLength
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && line[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		buffer.WriteString(line[:cut] + "\r\n ")
+		line = line[cut:]
+		// Continuation lines start with a space, which counts towards their length
+		limit = icsLineLength - 1
+	}
+	buffer.WriteString(line + "\r\n")
+}
+
+// Escape a TEXT value as iCalendar requires
+func escapeICSText(text string) string {
+	text = strings.Replace(text, "\\", "\\\\", -1)
+	text = strings.Replace(text, ";", "\\;", -1)
+	text = strings.Replace(text, ",", "\\,", -1)
+	text = strings.Replace(text, "\r\n", "\\n", -1)
+	text = strings.Replace(text, "\n", "\\n", -1)
+	return text
+}
+
+// Serve a calendar feed of each guild's upcoming Events at /calendar/<guild ID>/<token>.ics that calendar apps can
+// subscribe to.  A guild's feed is off until one of its managers turns it on with !event feed.
+func ServeCalendarFeed(s *discordgo.Session, addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/calendar/", func(w http.ResponseWriter, r *http.Request) {
+		handleCalendarFeed(s, w, r)
+	})
+
+	fmt.Println("Serving calendar feed on " + addr)
+	err := http.ListenAndServe(addr, mux)
+	if err != nil {
+		fmt.Println("Error serving calendar feed: " + err.Error())
+	}
+}
+
+func handleCalendarFeed(s *discordgo.Session, w http.ResponseWriter, r *http.Request) {
+	splitPath := strings.SplitN(strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/calendar/"), ".ics"), "/", 2)
+	if len(splitPath) != 2 {
+		http.NotFound(w, r)
+		return
+	}
+	guildID, token := splitPath[0], splitPath[1]
+
+	// Only serve feeds for guilds the bot is in
+	guild, err := s.State.Guild(guildID)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	// Guild IDs are public, so the link also has to have the guild's token in it
+	expected, err := RetrieveCalendarToken(guildID)
+	if err != nil {
+		fmt.Println("Error retrieving calendar token: " + err.Error())
+		http.Error(w, "Error retrieving events", http.StatusInternalServerError)
+		return
+	}
+	if expected == "" || subtle.ConstantTimeCompare([]byte(token), []byte(expected)) != 1 {
+		http.NotFound(w, r)
+		return
+	}
+
+	now := time.Now()
+	events, err := RetrieveUpcomingEvents(guildID, now)
+	if err != nil {
+		fmt.Println("Error retrieving events for calendar feed: " + err.Error())
+		http.Error(w, "Error retrieving events", http.StatusInternalServerError)
+		return
+	}
+
+	calendar, err := CalendarICS(events, guild.Name+" events", now)
+	if err != nil {
+		fmt.Println("Error building calendar feed: " + err.Error())
+		http.Error(w, "Error building calendar", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Write([]byte(calendar))
+}
+
+// The link to a guild's calendar feed
+func CalendarFeedURL(guildID string, token string) string {
+	return strings.TrimSuffix(CALENDAR_URL, "/") + "/calendar/" + guildID + "/" + token + ".ics"
+}
+
+// Make a new random token for a calendar feed link
+func newCalendarToken() (string, error) {
+	token := make([]byte, calendarTokenBytes)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(token), nil
+}
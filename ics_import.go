@@ -0,0 +1,361 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Largest .ics attachment that will be downloaded for !event import
+	maxImportSize = 1 << 20
+
+	// Most VEVENTs imported from one file, to keep a bad file from flooding the planner
+	maxImportEvents = 200
+
+	// How long downloading an .ics file can take before the import gives up
+	importDownloadTimeout = 15 * time.Second
+)
+
+var (
+	// Downloads .ics files to import, giving up on slow ones so they don't hold up the command
+	importClient = &http.Client{Timeout: importDownloadTimeout}
+)
+
+// A content line from an iCalendar file, e.g. DTSTART;TZID=America/New_York:20261021T190000
+type icsProperty struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// The properties of a VEVENT read from an iCalendar file, keyed by property name
+type icsEvent map[string][]*icsProperty
+
+// The first property with the given name, or nil if there isn't one
+func (vevent icsEvent) get(name string) *icsProperty {
+	if properties := vevent[name]; len(properties) > 0 {
+		return properties[0]
+	}
+	return nil
+}
+
+// The unescaped TEXT value of a property, or an empty string if there isn't one
+func (vevent icsEvent) text(name string) string {
+	if property := vevent.get(name); property != nil {
+		return unescapeICSText(property.value)
+	}
+	return ""
+}
+
+// What happened to each VEVENT in an imported iCalendar file
+type ImportReport struct {
+	imported   []string
+	duplicates []string
+	skipped    []string
+}
+
+// Download an .ics file attached to a Discord message
+func DownloadICS(url string) (string, error) {
+	resp, err := importClient.Get(url)
+	if err != nil {
+		return "", errors.New("I couldn't download that file.")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.New("I couldn't download that file.")
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxImportSize+1))
+	if err != nil {
+		return "", errors.New("I couldn't download that file.")
+	}
+	if len(body) > maxImportSize {
+		return "", errors.New("That file is too big to import.")
+	}
+	return string(body), nil
+}
+
+// Read the VEVENTs out of an iCalendar file.  Properties of components nested in a VEVENT, like VALARMs, are ignored.
+func ParseICS(data string) ([]icsEvent, error) {
+	// Unfold continuation lines, accepting files with bare LF line endings too
+	data = strings.Replace(data, "\r\n", "\n", -1)
+	data = strings.Replace(data, "\n ", "", -1)
+	data = strings.Replace(data, "\n\t", "", -1)
+	if !strings.HasPrefix(strings.ToUpper(strings.TrimSpace(strings.TrimPrefix(data, "\ufeff"))), "BEGIN:VCALENDAR") {
+		return nil, errors.New("That doesn't look like an iCalendar (.ics) file.")
+	}
+
+	var events []icsEvent
+	var components []string
+	var current icsEvent
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if line == "" {
+			continue
+		}
+		property, err := parseICSLine(line)
+		if err != nil {
+			return nil, err
+		}
+
+		switch property.name {
+		case "BEGIN", "END":
+			property.value = strings.ToUpper(property.value)
+		}
+
+		switch property.name {
+		case "BEGIN":
+			if property.value == "VEVENT" && len(components) == 1 && components[0] == "VCALENDAR" {
+				current = make(icsEvent)
+			}
+			components = append(components, property.value)
+		case "END":
+			if len(components) == 0 || components[len(components)-1] != property.value {
+				return nil, errors.New("The calendar file has a mismatched END:" + property.value + ".")
+			}
+			components = components[:len(components)-1]
+			if current != nil && len(components) == 1 && property.value == "VEVENT" {
+				events = append(events, current)
+				current = nil
+			}
+		default:
+			if current != nil && len(components) == 2 {
+				current[property.name] = append(current[property.name], property)
+			}
+		}
+	}
+
+	if len(components) != 0 {
+		return nil, errors.New("The calendar file ends in the middle of a " + components[len(components)-1] + ".")
+	}
+	return events, nil
+}
+
+// Split a content line into its name, parameters and value.  Parameter values may be quoted and contain : or ;
+func parseICSLine(line string) (*icsProperty, error) {
+	property := icsProperty{params: make(map[string]string)}
+
+	var parts []string
+	quoted, found := false, false
+	start := 0
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '"':
+			quoted = !quoted
+		case ';', ':':
+			if quoted {
+				continue
+			}
+			parts = append(parts, line[start:i])
+			start = i + 1
+			if line[i] == ':' {
+				property.value = line[start:]
+				found = true
+				i = len(line)
+			}
+		}
+	}
+	if !found || parts[0] == "" {
+		return nil, errors.New("The calendar file has a malformed line: " + line)
+	}
+
+	property.name = strings.ToUpper(parts[0])
+	for _, param := range parts[1:] {
+		keyValue := strings.SplitN(param, "=", 2)
+		if len(keyValue) == 2 {
+			property.params[strings.ToUpper(keyValue[0])] = strings.Trim(keyValue[1], "\"")
+		}
+	}
+	return &property, nil
+}
+
+// Undo the escaping of an iCalendar TEXT value
+func unescapeICSText(text string) string {
+	var buffer bytes.Buffer
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\\' && i+1 < len(text) {
+			i++
+			switch text[i] {
+			case 'n', 'N':
+				buffer.WriteByte('\n')
+			default:
+				buffer.WriteByte(text[i])
+			}
+			continue
+		}
+		buffer.WriteByte(text[i])
+	}
+	return buffer.String()
+}
+
+// Work out the time a DATE-TIME property refers to and the timezone it was written in
+// Floating times, and times in timezones Go doesn't know, are taken to be in defaultLoc
+func icsPropertyTime(property *icsProperty, value string, defaultLoc *time.Location) (time.Time, *time.Location,
+	error) {
+	loc := defaultLoc
+	if tzid := property.params["TZID"]; tzid != "" {
+		if named, err := time.LoadLocation(tzid); err == nil {
+			loc = named
+		}
+	}
+	t, err := parseICalTime(strings.ToUpper(value), loc)
+	if strings.HasSuffix(strings.ToUpper(value), "Z") {
+		loc = defaultLoc
+	}
+	return t, loc, err
+}
+
+// Create Events in a guild from the VEVENTs in an iCalendar file.  Recurring VEVENTs become recurring Events, with
+// their EXDATEs cancelled.  VEVENTs that can't be represented, or that match an existing Event's name and start time
+// in the guild, are left out and listed in the report.  If something goes wrong partway through, the report of what
+// was imported before then is returned along with the error.
+func ImportICS(guildID string, data string, defaultLoc *time.Location, creator, creatorID string,
+	now time.Time) (*ImportReport, error) {
+	vevents, err := ParseICS(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(vevents) > maxImportEvents {
+		return nil, errors.New("That file has " + strconv.Itoa(len(vevents)) + " events.  At most " +
+			strconv.Itoa(maxImportEvents) + " can be imported at once.")
+	}
+
+	report := ImportReport{}
+	seen := make(map[string]bool)
+	for _, vevent := range vevents {
+		name := strings.TrimSpace(vevent.text("SUMMARY"))
+		label := "**" + name + "**"
+		if name == "" {
+			name = "(untitled)"
+			label = "An untitled event"
+		}
+
+		start := vevent.get("DTSTART")
+		switch {
+		case vevent.get("RECURRENCE-ID") != nil:
+			report.skipped = append(report.skipped, label+": changes to a single date of a series aren't imported")
+			continue
+		case strings.ToUpper(vevent.text("STATUS")) == "CANCELLED":
+			report.skipped = append(report.skipped, label+": cancelled")
+			continue
+		case start == nil:
+			report.skipped = append(report.skipped, label+": no start time")
+			continue
+		case strings.ToUpper(start.params["VALUE"]) == "DATE" || len(start.value) == 8:
+			report.skipped = append(report.skipped, label+": all-day events need a start time")
+			continue
+		}
+
+		startsAt, loc, err := icsPropertyTime(start, start.value, defaultLoc)
+		if err != nil {
+			report.skipped = append(report.skipped, label+": unreadable start time "+start.value)
+			continue
+		}
+		label += " on " + startsAt.In(loc).Format(eventTimeLayout)
+
+		var rule *Recurrence
+		if property := vevent.get("RRULE"); property != nil {
+			rule, err = ParseRRule(property.value, loc)
+			if err != nil {
+				report.skipped = append(report.skipped, label+": "+err.Error())
+				continue
+			}
+		}
+		if (rule == nil && startsAt.Before(now)) ||
+			(rule != nil && len(rule.Occurrences(startsAt, loc, now, time.Time{}, 1)) == 0) {
+			report.skipped = append(report.skipped, label+": already happened")
+			continue
+		}
+
+		key := name + "@" + strconv.FormatInt(startsAt.Unix(), 10)
+		existing, err := eventStore.RetrieveEventByNameAndStart(guildID, name, startsAt)
+		if err != nil {
+			return &report, err
+		}
+		if len(existing) > 0 || seen[key] {
+			report.duplicates = append(report.duplicates, label)
+			continue
+		}
+		seen[key] = true
+
+		// A recurring Event is created along with how it repeats and its EXDATEs, so a failure can't leave behind an
+		// Event that happens once, or on dates that were meant to be skipped
+		var event *Event
+		if rule == nil {
+			event, err = eventStore.CreateEvent(guildID, name, vevent.text("DESCRIPTION"), vevent.text("LOCATION"),
+				startsAt, loc.String(), 0, creator, creatorID)
+		} else {
+			event, err = eventStore.CreateSeries(guildID, name, vevent.text("DESCRIPTION"), vevent.text("LOCATION"),
+				startsAt, loc.String(), 0, creator, creatorID, rule, icsExcludedOccurrences(vevent, startsAt, loc))
+		}
+		if err != nil {
+			return &report, err
+		}
+		idStr := strconv.FormatInt(event.id, 10)
+		report.imported = append(report.imported, "ID "+idStr+": "+label)
+
+		err = ScheduleReminders(event)
+		if err != nil {
+			return &report, err
+		}
+	}
+
+	return &report, nil
+}
+
+// The occurrences of a recurring VEVENT that its EXDATEs leave out, skipping any that can't be read
+func icsExcludedOccurrences(vevent icsEvent, startsAt time.Time, loc *time.Location) []int64 {
+	var occurrences []int64
+	for _, exdate := range vevent["EXDATE"] {
+		for _, value := range strings.Split(exdate.value, ",") {
+			t, _, err := icsPropertyTime(exdate, value, loc)
+			if err != nil {
+				continue
+			}
+			if len(value) == 8 {
+				// A date excludes whichever occurrence falls on it
+				t = time.Date(t.Year(), t.Month(), t.Day(), startsAt.In(loc).Hour(), startsAt.In(loc).Minute(), 0, 0,
+					loc)
+			}
+			occurrences = append(occurrences, t.Unix())
+		}
+	}
+	return occurrences
+}
+
+// Summarize an ImportReport as a Discord message, leaving out entries that would make it too long
+func (report *ImportReport) String() string {
+	var buffer bytes.Buffer
+	buffer.WriteString("Imported " + pluralize(int64(len(report.imported)), "event") + ", skipped " +
+		strconv.Itoa(len(report.skipped)) + ", " + pluralize(int64(len(report.duplicates)), "duplicate") + ".\n")
+
+	sections := []struct {
+		title   string
+		entries []string
+	}{
+		{"__Imported__", report.imported},
+		{"__Duplicates__ (already planned)", report.duplicates},
+		{"__Skipped__", report.skipped},
+	}
+	for _, section := range sections {
+		if len(section.entries) == 0 {
+			continue
+		}
+		buffer.WriteString(section.title + "\n")
+		for i, entry := range section.entries {
+			// Discord messages are limited to 2000 characters
+			if buffer.Len()+len(entry) > 1900 {
+				buffer.WriteString("…and " + strconv.Itoa(len(section.entries)-i) + " more\n")
+				break
+			}
+			buffer.WriteString(entry + "\n")
+		}
+	}
+	return buffer.String()
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// Wrap VEVENT content lines in an iCalendar file
+func testICS(vevents ...[]string) string {
+	data := "BEGIN:VCALENDAR\r\nVERSION:2.0\r\n"
+	for _, lines := range vevents {
+		data += "BEGIN:VEVENT\r\n" + strings.Join(lines, "\r\n") + "\r\nEND:VEVENT\r\n"
+	}
+	return data + "END:VCALENDAR\r\n"
+}
+
+func TestParseICSLine(t *testing.T) {
+	cases := []struct {
+		line       string
+		wantName   string
+		wantParams map[string]string
+		wantValue  string
+		wantErr    bool
+	}{
+		{"SUMMARY:Board games", "SUMMARY", map[string]string{}, "Board games", false},
+		{"dtstart;tzid=America/New_York:20271021T190000", "DTSTART", map[string]string{"TZID": "America/New_York"},
+			"20271021T190000", false},
+		{"DTSTART;TZID=\"GMT+1:00; Paris\";VALUE=DATE-TIME:20271021T190000", "DTSTART",
+			map[string]string{"TZID": "GMT+1:00; Paris", "VALUE": "DATE-TIME"}, "20271021T190000", false},
+		{"DESCRIPTION:At 7:30: games", "DESCRIPTION", map[string]string{}, "At 7:30: games", false},
+		{"SUMMARY", "", nil, "", true},
+		{":Board games", "", nil, "", true},
+	}
+
+	for _, c := range cases {
+		property, err := parseICSLine(c.line)
+		if (err != nil) != c.wantErr {
+			t.Fatalf("%q: got error %v, want error %v", c.line, err, c.wantErr)
+		}
+		if err != nil {
+			continue
+		}
+		if property.name != c.wantName || property.value != c.wantValue || len(property.params) != len(c.wantParams) {
+			t.Fatalf("%q: got %+v", c.line, property)
+		}
+		for key, value := range c.wantParams {
+			if property.params[key] != value {
+				t.Fatalf("%q: got %s=%q, want %q", c.line, key, property.params[key], value)
+			}
+		}
+	}
+}
+
+func TestParseICS(t *testing.T) {
+	cases := []struct {
+		name        string
+		data        string
+		wantEvents  int
+		wantSummary string // SUMMARY of the first VEVENT
+		wantErr     bool
+	}{
+		{"folded lines", "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nSUMMARY:Board\r\n  games\\, pizza\r\nEND:VEVENT\r\n" +
+			"END:VCALENDAR\r\n", 1, "Board games, pizza", false},
+		{"bare line feeds", "BEGIN:VCALENDAR\nBEGIN:VEVENT\nSUMMARY:Games\nEND:VEVENT\nEND:VCALENDAR\n", 1, "Games",
+			false},
+		{"nested components", "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nSUMMARY:Games\r\nBEGIN:VALARM\r\nSUMMARY:Alarm\r\n" +
+			"END:VALARM\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n", 1, "Games", false},
+		{"several events", testICS([]string{"SUMMARY:One"}, []string{"SUMMARY:Two"}), 2, "One", false},
+		{"not a calendar", "Hello", 0, "", true},
+		{"mismatched end", "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nEND:VTODO\r\nEND:VCALENDAR\r\n", 0, "", true},
+		{"truncated", "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nSUMMARY:Games\r\n", 0, "", true},
+	}
+
+	for _, c := range cases {
+		events, err := ParseICS(c.data)
+		if (err != nil) != c.wantErr {
+			t.Fatalf("%s: got error %v, want error %v", c.name, err, c.wantErr)
+		}
+		if len(events) != c.wantEvents {
+			t.Fatalf("%s: got %d events, want %d", c.name, len(events), c.wantEvents)
+		}
+		if len(events) > 0 && events[0].text("SUMMARY") != c.wantSummary {
+			t.Fatalf("%s: got summary %q, want %q", c.name, events[0].text("SUMMARY"), c.wantSummary)
+		}
+	}
+}
+
+func TestImportICS(t *testing.T) {
+	newYork, _ := time.LoadLocation("America/New_York")
+	now := time.Date(2026, time.October, 18, 12, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name   string
+		vevent []string
+		want   string // imported, duplicate or skipped
+	}{
+		{"single", []string{"SUMMARY:Picnic", "DTSTART:20271101T180000Z"}, "imported"},
+		{"already planned", []string{"SUMMARY:Picnic", "DTSTART:20271101T180000Z"}, "duplicate"},
+		{"floating", []string{"SUMMARY:Hike", "DTSTART:20271102T090000"}, "imported"},
+		{"ongoing series", []string{"SUMMARY:Games", "DTSTART;TZID=America/Chicago:20250102T190000",
+			"RRULE:FREQ=WEEKLY"}, "imported"},
+		{"changed occurrence", []string{"SUMMARY:Games", "DTSTART:20271101T180000Z",
+			"RECURRENCE-ID:20271101T170000Z"}, "skipped"},
+		{"cancelled", []string{"SUMMARY:Party", "DTSTART:20271101T180000Z", "STATUS:CANCELLED"}, "skipped"},
+		{"no start", []string{"SUMMARY:Party"}, "skipped"},
+		{"all day", []string{"SUMMARY:Party", "DTSTART;VALUE=DATE:20271101"}, "skipped"},
+		{"unreadable start", []string{"SUMMARY:Party", "DTSTART:tomorrow"}, "skipped"},
+		{"past", []string{"SUMMARY:Party", "DTSTART:20251101T180000Z"}, "skipped"},
+		{"ended series", []string{"SUMMARY:Party", "DTSTART:20251101T180000Z", "RRULE:FREQ=DAILY;COUNT=3"},
+			"skipped"},
+		{"unsupported rule", []string{"SUMMARY:Party", "DTSTART:20271101T180000Z", "RRULE:FREQ=YEARLY"}, "skipped"},
+	}
+
+	forEachStore(t, func(t *testing.T) {
+		for _, c := range cases {
+			report, err := ImportICS("guild", testICS(c.vevent), newYork, "creator", "1", now)
+			if err != nil {
+				t.Fatalf("%s: %v", c.name, err)
+			}
+			outcomes := map[string]int{"imported": len(report.imported), "duplicate": len(report.duplicates),
+				"skipped": len(report.skipped)}
+			for outcome, count := range outcomes {
+				if (outcome == c.want) != (count == 1) || count > 1 {
+					t.Fatalf("%s: got %+v, want it %s", c.name, report, c.want)
+				}
+			}
+		}
+
+		// Floating times are in the importing guild's timezone
+		events, err := eventStore.RetrieveEventByName("guild", "Hike")
+		if err != nil || len(events) != 1 {
+			t.Fatalf("got %v, %v", events, err)
+		}
+		if !events[0].startsAt.Equal(time.Date(2027, 11, 2, 9, 0, 0, 0, newYork)) ||
+			events[0].timezone != "America/New_York" {
+			t.Fatalf("got %v in %s", events[0].startsAt, events[0].timezone)
+		}
+
+		// The same VEVENT twice in one file is only imported once
+		report, err := ImportICS("other", testICS(cases[0].vevent, cases[0].vevent), newYork, "creator", "1", now)
+		if err != nil || len(report.imported) != 1 || len(report.duplicates) != 1 {
+			t.Fatalf("got %+v, %v", report, err)
+		}
+	})
+}
+
+func TestImportICSTooManyEvents(t *testing.T) {
+	var vevents [][]string
+	for i := 0; i <= maxImportEvents; i++ {
+		vevents = append(vevents, []string{"SUMMARY:Picnic", "DTSTART:20271101T180000Z"})
+	}
+
+	forEachStore(t, func(t *testing.T) {
+		report, err := ImportICS("guild", testICS(vevents...), time.UTC, "creator", "1", time.Now())
+		if err == nil || report != nil {
+			t.Fatalf("got %+v, %v, want an error", report, err)
+		}
+		events, _ := eventStore.RetrieveEventByName("guild", "Picnic")
+		if len(events) != 0 {
+			t.Fatalf("got %d events, want none", len(events))
+		}
+	})
+}
+
+func TestICSRoundTrip(t *testing.T) {
+	newYork, _ := time.LoadLocation("America/New_York")
+	startsAt := time.Date(2027, time.October, 21, 19, 0, 0, 0, newYork)
+	now := time.Date(2026, time.October, 18, 12, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name      string
+		rule      string // empty if the Event doesn't repeat
+		cancelled []int64
+	}{
+		{"single", "", nil},
+		{"weekly", "FREQ=WEEKLY;BYDAY=MO,TH;COUNT=10", []int64{startsAt.AddDate(0, 0, 7).Unix()}},
+		{"monthly", "FREQ=MONTHLY;BYDAY=-1FR;UNTIL=20281231T235959Z", nil},
+		// The series crosses the end of daylight saving time, and the cancelled occurrences are on both sides of it
+		{"daily", "FREQ=DAILY;INTERVAL=3", []int64{startsAt.AddDate(0, 0, 3).Unix(), startsAt.AddDate(0, 0, 18).Unix()}},
+	}
+
+	forEachStore(t, func(t *testing.T) {
+		for _, c := range cases {
+			var rule *Recurrence
+			var original *Event
+			var err error
+			if c.rule == "" {
+				original, err = eventStore.CreateEvent("export", c.name, "", "Park, by the lake", startsAt,
+					"America/New_York", 0, "creator", "1")
+			} else {
+				rule, _ = ParseRRule(c.rule, newYork)
+				original, err = eventStore.CreateSeries("export", c.name, "", "Park, by the lake", startsAt,
+					"America/New_York", 0, "creator", "1", rule, c.cancelled)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			calendar, err := EventICS(original, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			report, err := ImportICS("import", calendar, time.UTC, "importer", "2", now)
+			if err != nil || len(report.imported) != 1 {
+				t.Fatalf("%s: got %+v, %v", c.name, report, err)
+			}
+
+			events, err := eventStore.RetrieveEventByName("import", c.name)
+			if err != nil || len(events) != 1 {
+				t.Fatalf("%s: got %v, %v", c.name, events, err)
+			}
+			imported := events[0]
+			if !imported.startsAt.Equal(startsAt) || imported.location != original.location {
+				t.Fatalf("%s: got %v at %q", c.name, imported.startsAt, imported.location)
+			}
+			if c.rule == "" {
+				if imported.recurrence != nil {
+					t.Fatalf("%s: got recurrence %s", c.name, imported.recurrence)
+				}
+				continue
+			}
+			if imported.recurrence == nil || imported.recurrence.String() != rule.String() ||
+				imported.timezone != "America/New_York" {
+				t.Fatalf("%s: got recurrence %v in %s", c.name, imported.recurrence, imported.timezone)
+			}
+
+			exceptions, err := eventStore.RetrieveEventExceptions(imported.id)
+			if err != nil || len(exceptions) != len(c.cancelled) {
+				t.Fatalf("%s: got exceptions %v, %v", c.name, exceptions, err)
+			}
+			for _, occurrence := range c.cancelled {
+				if exception := exceptions[occurrence]; exception == nil || !exception.cancelled {
+					t.Fatalf("%s: occurrence %v isn't cancelled", c.name, time.Unix(occurrence, 0))
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestWriteICSLine(t *testing.T) {
+	cases := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{"SUMMARY", "Board games", "SUMMARY:Board games\r\n"},
+		{"DESCRIPTION", strings.Repeat("a", 70), "DESCRIPTION:" + strings.Repeat("a", 63) + "\r\n " +
+			strings.Repeat("a", 7) + "\r\n"},
+		// Continuation lines are one byte shorter because of the leading space
+		{"X", strings.Repeat("b", 160), "X:" + strings.Repeat("b", 73) + "\r\n " + strings.Repeat("b", 74) + "\r\n " +
+			strings.Repeat("b", 13) + "\r\n"},
+		// é is two bytes long, and the line isn't split between them
+		{"SUMMARY", strings.Repeat("a", 66) + "é", "SUMMARY:" + strings.Repeat("a", 66) + "\r\n é\r\n"},
+	}
+
+	for _, c := range cases {
+		var buffer bytes.Buffer
+		writeICSLine(&buffer, c.name, c.value)
+		if buffer.String() != c.want {
+			t.Fatalf("%s:%s: got %q, want %q", c.name, c.value, buffer.String(), c.want)
+		}
+	}
+}
+
+func TestEscapeICSText(t *testing.T) {
+	cases := []struct {
+		text string
+		want string
+	}{
+		{"Board games", "Board games"},
+		{"Games, pizza; drinks", "Games\\, pizza\\; drinks"},
+		{"C:\\Games", "C:\\\\Games"},
+		{"Line one\nline two\r\nline three", "Line one\\nline two\\nline three"},
+	}
+
+	for _, c := range cases {
+		if got := escapeICSText(c.text); got != c.want {
+			t.Fatalf("%q: got %q, want %q", c.text, got, c.want)
+		}
+		if got := unescapeICSText(escapeICSText(c.text)); got != strings.Replace(c.text, "\r\n", "\n", -1) {
+			t.Fatalf("%q: unescaped to %q", c.text, got)
+		}
+	}
+}
+
+func TestCalendarICS(t *testing.T) {
+	newYork, _ := time.LoadLocation("America/New_York")
+	startsAt := time.Date(2027, time.October, 21, 19, 0, 0, 0, newYork)
+	rule, _ := ParseRRule("FREQ=WEEKLY;BYDAY=TH", newYork)
+	now := time.Date(2026, time.October, 18, 12, 0, 0, 0, time.UTC)
+
+	forEachStore(t, func(t *testing.T) {
+		single := createTestEvent(t, "guild", "Picnic", time.Date(2027, 11, 1, 18, 0, 0, 0, time.UTC), 0, "1")
+		cancelled := createTestEvent(t, "guild", "Hike", time.Date(2027, 11, 2, 18, 0, 0, 0, time.UTC), 0, "1")
+		err := eventStore.CancelEvent(strconv.FormatInt(cancelled.id, 10), "Rain", now, "1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		cancelled, _ = eventStore.RetrieveEventByID(strconv.FormatInt(cancelled.id, 10))
+		series, err := eventStore.CreateSeries("guild", "Board games, pizza", "", "", startsAt, "America/New_York",
+			0, "creator", "1", rule, []int64{startsAt.AddDate(0, 0, 7).Unix()})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		calendar, err := CalendarICS([]*Event{single, cancelled, series}, "Guild events", now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, line := range strings.Split(strings.TrimSuffix(calendar, "\r\n"), "\r\n") {
+			if len(line) > icsLineLength {
+				t.Fatalf("line is longer than %d bytes: %q", icsLineLength, line)
+			}
+		}
+
+		// Each VEVENT, split on its BEGIN line, and the lines it should have
+		vevents := strings.Split(calendar, "BEGIN:VEVENT\r\n")
+		cases := []struct {
+			vevent string
+			want   []string
+		}{
+			{vevents[0], []string{"BEGIN:VCALENDAR", "X-WR-CALNAME:Guild events", "TZID:America/New_York"}},
+			{vevents[1], []string{"UID:" + strconv.FormatInt(single.id, 10) + "@discord-event-planner",
+				"DTSTAMP:20261018T120000Z", "DTSTART:20271101T180000Z", "SUMMARY:Picnic", "LOCATION:Park",
+				"STATUS:CONFIRMED"}},
+			{vevents[2], []string{"DTSTART:20271102T180000Z", "SUMMARY:Hike", "STATUS:CANCELLED"}},
+			{vevents[3], []string{"DTSTART;TZID=America/New_York:20271021T190000", "SUMMARY:Board games\\, pizza",
+				"RRULE:FREQ=WEEKLY;BYDAY=TH", "EXDATE;TZID=America/New_York:20271028T190000", "STATUS:CONFIRMED",
+				"END:VCALENDAR"}},
+		}
+		if len(vevents) != len(cases) {
+			t.Fatalf("got %d VEVENTs, want %d", len(vevents)-1, len(cases)-1)
+		}
+		for i, c := range cases {
+			for _, line := range c.want {
+				if !strings.Contains(c.vevent, line+"\r\n") {
+					t.Fatalf("VEVENT %d is missing %q:\n%s", i, line, c.vevent)
+				}
+			}
+		}
+	})
+}
+
+func TestCalendarFeed(t *testing.T) {
+	forEachStore(t, func(t *testing.T) {
+		s, _ := discordgo.New("Bot token")
+		s.State.GuildAdd(&discordgo.Guild{ID: "guild", Name: "Guild"})
+		token, err := newCalendarToken()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		get := func(path string) int {
+			w := httptest.NewRecorder()
+			handleCalendarFeed(s, w, httptest.NewRequest("GET", path, nil))
+			return w.Code
+		}
+
+		cases := []struct {
+			name  string
+			token string // the guild's token, or empty if its feed is off
+			path  string
+			want  int
+		}{
+			{"off", "", "/calendar/guild/.ics", 404},
+			{"no token", token, "/calendar/guild.ics", 404},
+			{"wrong token", token, "/calendar/guild/" + strings.Repeat("0", len(token)) + ".ics", 404},
+			{"other guild", token, "/calendar/other/" + token + ".ics", 404},
+			{"right token", token, "/calendar/guild/" + token + ".ics", 200},
+		}
+		for _, c := range cases {
+			err = UpdateCalendarToken("guild", c.token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := get(c.path); got != c.want {
+				t.Fatalf("%s: got status %d, want %d", c.name, got, c.want)
+			}
+		}
+	})
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"io/ioutil"
+	"math/bits"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// Largest image attachment that will be downloaded to check for reposts
+	maxHashedImageSize = 8 << 20
+
+	// Most pixels an image can have and still be decoded to check for reposts
+	maxHashedImagePixels = 40000000
+
+	// Most images in a guild a new one is compared against when checking for reposts, starting from the most recent
+	maxComparedImages = 10000
+
+	// How long downloading an image can take before it is skipped
+	imageDownloadTimeout = 15 * time.Second
+)
+
+var (
+	// How many bits two images' hashes can differ by for one to count as a repost of the other, or -1 to not check
+	// images for reposts at all
+	IMAGE_REPOST_DISTANCE int = 6
+
+	// Downloads images to hash them, giving up on slow ones so they don't hold up repost detection
+	imageClient = &http.Client{Timeout: imageDownloadTimeout}
+)
+
+// Work out the perceptual hashes of the images attached to a message, skipping any that can't be downloaded or decoded
+// GIFs are hashed by their first frame
+func HashImageAttachments(attachments []*discordgo.MessageAttachment) []uint64 {
+	if IMAGE_REPOST_DISTANCE < 0 {
+		return nil
+	}
+
+	var hashes []uint64
+	for _, attachment := range attachments {
+		if !strings.HasPrefix(attachment.ContentType, "image/") && attachment.Width == 0 {
+			continue
+		}
+		if attachment.Size > maxHashedImageSize {
+			continue
+		}
+		img, err := downloadImage(attachment.URL)
+		if err != nil {
+			continue
+		}
+		hashes = append(hashes, DifferenceHash(img))
+	}
+	return hashes
+}
+
+func downloadImage(url string) (image.Image, error) {
+	resp, err := imageClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("downloading image: " + resp.Status)
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxHashedImageSize))
+	if err != nil {
+		return nil, err
+	}
+
+	// A small file can still decode to an enormous image, check its size first
+	config, _, err := image.DecodeConfig(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if config.Width*config.Height > maxHashedImagePixels {
+		return nil, errors.New("image is too large to hash")
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(body))
+	return img, err
+}
+
+// Compute a 64 bit difference hash (dHash) of an image.  The image is shrunk to 9x8 shades of gray, and each bit
+// says whether a pixel is brighter than the one to its right, so resizing, recompressing or slightly recoloring an
+// image barely changes its hash.
+func DifferenceHash(img image.Image) uint64 {
+	const width, height = 9, 8
+	var gray [height][width]float64
+
+	bounds := img.Bounds()
+	for y := 0; y < height; y++ {
+		top := bounds.Min.Y + y*bounds.Dy()/height
+		bottom := bounds.Min.Y + (y+1)*bounds.Dy()/height
+		for x := 0; x < width; x++ {
+			left := bounds.Min.X + x*bounds.Dx()/width
+			right := bounds.Min.X + (x+1)*bounds.Dx()/width
+			gray[y][x] = averageLuminance(img, left, top, right, bottom)
+		}
+	}
+
+	var hash uint64
+	for y := 0; y < height; y++ {
+		for x := 0; x < width-1; x++ {
+			hash <<= 1
+			if gray[y][x] > gray[y][x+1] {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// The average brightness of a rectangle of an image.  Large rectangles are sampled rather than read pixel by pixel.
+func averageLuminance(img image.Image, left, top, right, bottom int) float64 {
+	if right <= left {
+		right = left + 1
+	}
+	if bottom <= top {
+		bottom = top + 1
+	}
+
+	step := 1
+	for (right-left)*(bottom-top)/(step*step) > 1024 {
+		step++
+	}
+
+	var total float64
+	var count int
+	for y := top; y < bottom; y += step {
+		for x := left; x < right; x += step {
+			r, g, b, _ := img.At(x, y).RGBA()
+			total += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+			count++
+		}
+	}
+	return total / float64(count)
+}
+
+// How many bits differ between two image hashes
+func HashDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var (
+	// Anything that looks like a link in a message, up to the next whitespace or angle bracket
+	urlPattern = regexp.MustCompile(`(?i)https?://[^\s<>]+`)
+
+	// Query parameters that only track where a link was shared from, so two links that differ only in them are the
+	// same link.  Parameters starting with utm_ are dropped too.
+	trackingParams = map[string]bool{
+		"fbclid":  true,
+		"gclid":   true,
+		"dclid":   true,
+		"msclkid": true,
+		"igshid":  true,
+		"igsh":    true,
+		"mc_cid":  true,
+		"mc_eid":  true,
+		"ref_src": true,
+		"ref_url": true,
+		"si":      true,
+		"feature": true,
+	}
+
+	// Subdomains sites serve the same pages on for phones, or out of habit
+	hostPrefixes = []string{"www.", "m.", "mobile.", "amp."}
+)
+
+// Find the links in a message and return their canonical forms, each only once
+func CanonicalURLs(message string) []string {
+	var urls []string
+	seen := make(map[string]bool)
+	for _, raw := range urlPattern.FindAllString(message, -1) {
+		raw = trimLinkEnd(raw)
+		canonical, ok := CanonicalURL(raw)
+		if ok && !seen[canonical] {
+			urls = append(urls, canonical)
+			seen[canonical] = true
+		}
+	}
+	return urls
+}
+
+// Drop punctuation and markdown after a link, which is usually the end of the sentence or formatting around it.
+// A closing parenthesis is kept if it closes one in the link, as in Wikipedia links.
+func trimLinkEnd(link string) string {
+	for len(link) > 0 {
+		last := link[len(link)-1]
+		if strings.IndexByte(".,:;!?'\"*_~|", last) < 0 &&
+			!(last == ')' && strings.Count(link, "(") < strings.Count(link, ")")) {
+			break
+		}
+		link = link[:len(link)-1]
+	}
+	return link
+}
+
+// Reduce a link to a form that is the same for every way of writing the same link: without its scheme, mobile
+// subdomain, tracking parameters, fragment or trailing slash, and with YouTube's short links expanded.
+// Returns false if the link can't be parsed.
+func CanonicalURL(raw string) (string, bool) {
+	parsed, err := url.Parse(raw)
+	if err != nil || parsed.Host == "" {
+		return "", false
+	}
+
+	host := strings.ToLower(parsed.Hostname())
+	host = strings.TrimSuffix(host, ".")
+	for _, prefix := range hostPrefixes {
+		host = strings.TrimPrefix(host, prefix)
+	}
+	if port := parsed.Port(); port != "" && port != "80" && port != "443" {
+		host += ":" + port
+	}
+
+	path := strings.TrimRight(parsed.EscapedPath(), "/")
+	query := parsed.Query()
+
+	switch host {
+	case "youtu.be":
+		// youtu.be/ID is youtube.com/watch?v=ID
+		host = "youtube.com"
+		query.Set("v", strings.TrimPrefix(path, "/"))
+		path = "/watch"
+	case "youtube.com", "music.youtube.com", "youtube-nocookie.com":
+		host = "youtube.com"
+		for _, prefix := range []string{"/shorts/", "/embed/", "/live/", "/v/"} {
+			if strings.HasPrefix(path, prefix) {
+				query.Set("v", strings.TrimPrefix(path, prefix))
+				path = "/watch"
+			}
+		}
+	}
+	if host == "youtube.com" && path == "/watch" {
+		// Only the video matters, not where it was shared from or the playlist it was in
+		query = url.Values{"v": {query.Get("v")}}
+	}
+
+	for param := range query {
+		if trackingParams[strings.ToLower(param)] || strings.HasPrefix(strings.ToLower(param), "utm_") {
+			query.Del(param)
+		}
+	}
+
+	canonical := host + path
+	if len(query) > 0 {
+		// Encode sorts the parameters, so their order doesn't matter either
+		canonical += "?" + query.Encode()
+	}
+	return canonical, true
+}
+
+// Reduce a domain, or a link to a site, to the form hosts take in canonical links
+// Returns false if it isn't a domain
+func CanonicalDomain(domain string) (string, bool) {
+	domain = strings.TrimSpace(domain)
+	if !strings.Contains(domain, "://") {
+		domain = "http://" + domain
+	}
+	canonical, ok := CanonicalURL(domain)
+	if !ok {
+		return "", false
+	}
+	host := strings.SplitN(canonical, "/", 2)[0]
+	host = strings.SplitN(host, "?", 2)[0]
+	return host, strings.Contains(host, ".")
+}
+
+// Check whether a link, in its canonical form, is on one of the domains or a subdomain of one
+func OnDomain(canonical string, domains []string) bool {
+	host := strings.SplitN(canonical, "/", 2)[0]
+	host = strings.SplitN(host, "?", 2)[0]
+	for _, domain := range domains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCanonicalURL(t *testing.T) {
+	cases := []struct {
+		raw    string
+		want   string
+		wantOk bool
+	}{
+		{"https://example.com/page", "example.com/page", true},
+		{"HTTP://WWW.Example.COM/page/", "example.com/page", true},
+		{"https://example.com:443/", "example.com", true},
+		{"https://example.com:8080/page", "example.com:8080/page", true},
+		{"https://m.example.com/page#comments", "example.com/page", true},
+		// Only the subdomains sites serve the same pages on are dropped
+		{"https://en.m.wikipedia.org/wiki/Go", "en.m.wikipedia.org/wiki/Go", true},
+		{"https://example.com/page?b=2&a=1", "example.com/page?a=1&b=2", true},
+		{"https://example.com/page?utm_source=feed&UTM_Medium=x&fbclid=1&id=7", "example.com/page?id=7", true},
+		{"https://example.com/Page", "example.com/Page", true},
+		{"https://youtu.be/abc?si=share", "youtube.com/watch?v=abc", true},
+		{"https://www.youtube.com/watch?v=abc&list=xyz&t=10", "youtube.com/watch?v=abc", true},
+		{"https://m.youtube.com/shorts/abc", "youtube.com/watch?v=abc", true},
+		{"https://www.youtube-nocookie.com/embed/abc", "youtube.com/watch?v=abc", true},
+		{"https://music.youtube.com/watch?v=abc&feature=share", "youtube.com/watch?v=abc", true},
+		{"https://www.youtube.com/@channel", "youtube.com/@channel", true},
+		{"https://", "", false},
+		{"https://exa mple.com/%zz", "", false},
+	}
+
+	for _, c := range cases {
+		got, ok := CanonicalURL(c.raw)
+		if got != c.want || ok != c.wantOk {
+			t.Fatalf("%q: got %q, %v, want %q, %v", c.raw, got, ok, c.want, c.wantOk)
+		}
+	}
+}
+
+func TestCanonicalURLs(t *testing.T) {
+	cases := []struct {
+		message string
+		want    []string
+	}{
+		{"No links here", nil},
+		{"Look at https://example.com/page.", []string{"example.com/page"}},
+		{"**https://example.com/page**, <https://www.example.com/page/>", []string{"example.com/page"}},
+		{"(see https://en.wikipedia.org/wiki/Go_(programming_language))",
+			[]string{"en.wikipedia.org/wiki/Go_(programming_language)"}},
+		{"https://youtu.be/abc and https://example.com/page?", []string{"youtube.com/watch?v=abc", "example.com/page"}},
+		{"ftp://example.com/file and http:/example.com", nil},
+	}
+
+	for _, c := range cases {
+		got := CanonicalURLs(c.message)
+		if strings.Join(got, " ") != strings.Join(c.want, " ") {
+			t.Fatalf("%q: got %q, want %q", c.message, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,997 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// An EventStore that keeps everything in memory, for tests and for trying the bot out without a database
+// It hands out copies so changes callers make to what they retrieve aren't saved unless they update the store
+type MemoryEventStore struct {
+	mutex sync.Mutex
+
+	events        map[int64]*Event
+	rsvps         []*memoryRSVP // in the order they were created
+	exceptions    map[int64]map[int64]*EventException
+	reminders     map[int64]*Reminder
+	cohosts       map[int64][]string
+	history       []*AuditEntry
+	guildSettings map[string]map[string]string
+	lastID        int64 // Events, RSVPs and Reminders share one sequence of IDs
+}
+
+// An RSVP along with when it joined the waitlist, which is what decides the order people come off it
+type memoryRSVP struct {
+	RSVP
+	waitlistedAt int64
+}
+
+func NewMemoryEventStore() *MemoryEventStore {
+	return &MemoryEventStore{
+		events:        make(map[int64]*Event),
+		exceptions:    make(map[int64]map[int64]*EventException),
+		reminders:     make(map[int64]*Reminder),
+		cohosts:       make(map[int64][]string),
+		guildSettings: make(map[string]map[string]string),
+	}
+}
+
+func (store *MemoryEventStore) nextID() int64 {
+	store.lastID++
+	return store.lastID
+}
+
+func (store *MemoryEventStore) CreateEvent(guildID, name, description, location string, startsAt time.Time,
+	timezone string, maxAttendees int64, creator, creatorID string) (*Event, error) {
+	return store.createEvent(guildID, name, description, location, startsAt, timezone, maxAttendees, creator,
+		creatorID, nil, nil)
+}
+
+func (store *MemoryEventStore) CreateSeries(guildID, name, description, location string, startsAt time.Time,
+	timezone string, maxAttendees int64, creator, creatorID string, rule *Recurrence,
+	cancelled []int64) (*Event, error) {
+	return store.createEvent(guildID, name, description, location, startsAt, timezone, maxAttendees, creator,
+		creatorID, rule, cancelled)
+}
+
+func (store *MemoryEventStore) createEvent(guildID, name, description, location string, startsAt time.Time,
+	timezone string, maxAttendees int64, creator, creatorID string, rule *Recurrence,
+	cancelled []int64) (*Event, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	event := Event{
+		id:           store.nextID(),
+		guildID:      guildID,
+		name:         name,
+		description:  description,
+		location:     location,
+		startsAt:     time.Unix(startsAt.Unix(), 0).UTC(),
+		timezone:     timezone,
+		maxAttendees: maxAttendees,
+		creator:      creator,
+		creatorID:    creatorID,
+		status:       EventScheduled,
+	}
+	if rule != nil {
+		recurrence := *rule
+		event.recurrence = &recurrence
+	}
+	store.events[event.id] = &event
+	for _, occurrence := range cancelled {
+		if store.exceptions[event.id] == nil {
+			store.exceptions[event.id] = make(map[int64]*EventException)
+		}
+		store.exceptions[event.id][occurrence] = &EventException{eventID: event.id, occurrence: occurrence,
+			cancelled: true}
+	}
+	store.audit(&AuditEntry{eventID: event.id, userID: creatorID, action: AuditCreate, newValue: name})
+	return copyEvent(&event), nil
+}
+
+// Add a change to an Event's history.  The caller must hold the mutex.
+func (store *MemoryEventStore) audit(entry *AuditEntry) {
+	entry.id = int64(len(store.history) + 1)
+	entry.changedAt = time.Unix(time.Now().Unix(), 0).UTC()
+	store.history = append(store.history, entry)
+}
+
+// Copy an Event so it can be handed out without sharing its Recurrence
+func copyEvent(event *Event) *Event {
+	copied := *event
+	if event.recurrence != nil {
+		recurrence := *event.recurrence
+		copied.recurrence = &recurrence
+	}
+	return &copied
+}
+
+func (store *MemoryEventStore) RetrieveEventByID(id string) (*Event, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	event, err := store.event(id)
+	if err != nil {
+		return nil, err
+	}
+	return copyEvent(event), nil
+}
+
+// Get the stored Event with an ID, which the caller must hold the mutex to use
+func (store *MemoryEventStore) event(id string) (*Event, error) {
+	eventID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return nil, sql.ErrNoRows
+	}
+	event, ok := store.events[eventID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return event, nil
+}
+
+func (store *MemoryEventStore) RetrieveEventByAnnouncement(messageID string) (*Event, error) {
+	events := store.findEvents(func(event *Event) bool {
+		return event.announceMessageID == messageID
+	})
+	if len(events) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return events[0], nil
+}
+
+func (store *MemoryEventStore) RetrieveEventByName(guildID string, name string) ([]*Event, error) {
+	return store.findEvents(func(event *Event) bool {
+		return event.guildID == guildID && event.status != EventCancelled &&
+			strings.Contains(strings.ToLower(event.name), strings.ToLower(name))
+	}), nil
+}
+
+func (store *MemoryEventStore) RetrieveEventByNameAndStart(guildID string, name string,
+	startsAt time.Time) ([]*Event, error) {
+	return store.findEvents(func(event *Event) bool {
+		return event.guildID == guildID && event.status != EventCancelled && event.name == name &&
+			event.startsAt.Unix() == startsAt.Unix()
+	}), nil
+}
+
+func (store *MemoryEventStore) RetrieveSingleEvents(filter EventFilter, now time.Time, limit int) ([]*Event, error) {
+	events := store.findEvents(func(event *Event) bool {
+		return event.recurrence == nil && event.startsAt.Before(now) == filter.past && store.matches(event, filter)
+	})
+
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].startsAt.Equal(events[j].startsAt) {
+			return events[i].id < events[j].id
+		}
+		if filter.past {
+			return events[i].startsAt.After(events[j].startsAt)
+		}
+		return events[i].startsAt.Before(events[j].startsAt)
+	})
+	if limit > 0 && len(events) > limit {
+		events = events[:limit]
+	}
+	return events, nil
+}
+
+func (store *MemoryEventStore) RetrieveSeries(filter EventFilter) ([]*Event, error) {
+	return store.findEvents(func(event *Event) bool {
+		return event.recurrence != nil && store.matches(event, filter)
+	}), nil
+}
+
+// Check whether an Event is in a filter's guild, hasn't been cancelled, and was created by or RSVPed to by its users
+// The caller must hold the mutex
+func (store *MemoryEventStore) matches(event *Event, filter EventFilter) bool {
+	if event.guildID != filter.guildID || event.status == EventCancelled {
+		return false
+	}
+	if filter.creatorID != "" && event.creatorID != filter.creatorID {
+		return false
+	}
+	if filter.rsvpUserID != "" {
+		for _, rsvp := range store.rsvps {
+			if rsvp.eventID == strconv.FormatInt(event.id, 10) && rsvp.userID == filter.rsvpUserID &&
+				(rsvp.status == "Going" || rsvp.status == "Maybe") {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// Get copies of the Events a function picks out, in the order they were created
+func (store *MemoryEventStore) findEvents(match func(event *Event) bool) []*Event {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	var events []*Event
+	for _, event := range store.events {
+		if match(event) {
+			events = append(events, copyEvent(event))
+		}
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].id < events[j].id
+	})
+	return events
+}
+
+func (store *MemoryEventStore) AssignUnscopedEvents(guildID string) (int64, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	var moved int64
+	for _, event := range store.events {
+		if event.guildID == "" {
+			event.guildID = guildID
+			moved++
+		}
+	}
+	return moved, nil
+}
+
+func (store *MemoryEventStore) CancelEvent(id string, reason string, cancelledAt time.Time, userID string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	event, err := store.event(id)
+	if err != nil {
+		return errors.New("Event not found.")
+	}
+
+	event.status = EventCancelled
+	event.cancelReason = reason
+	event.cancelledAt = time.Unix(cancelledAt.Unix(), 0).UTC()
+	store.audit(&AuditEntry{eventID: event.id, userID: userID, action: AuditCancel, newValue: reason})
+	for reminderID, reminder := range store.reminders {
+		if reminder.eventID == id {
+			delete(store.reminders, reminderID)
+		}
+	}
+	return nil
+}
+
+func (store *MemoryEventStore) RestoreEvent(id string, userID string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	event, err := store.event(id)
+	if err != nil || event.status != EventCancelled {
+		return errors.New("That event isn't cancelled.")
+	}
+
+	event.status = EventScheduled
+	event.cancelReason = ""
+	event.cancelledAt = time.Time{}
+	store.audit(&AuditEntry{eventID: event.id, userID: userID, action: AuditRestore})
+	return nil
+}
+
+func (store *MemoryEventStore) CompletePastEvents(now time.Time) (int64, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	var completed int64
+	for _, event := range store.events {
+		if event.status == EventScheduled && event.recurrence == nil && event.startsAt.Before(now) {
+			event.status = EventCompleted
+			completed++
+		}
+	}
+	return completed, nil
+}
+
+func (store *MemoryEventStore) UpdateEventColumns(id string, changes []ColumnChange, editorID string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	event, err := store.event(id)
+	if err != nil {
+		// Like an UPDATE that matches no rows
+		return nil
+	}
+
+	// Make the changes to a copy so nothing is saved if any of them fail
+	updated := copyEvent(event)
+	var history []*AuditEntry
+	for _, change := range changes {
+		oldValue := memoryEventColumn(updated, change.column)
+		err = setMemoryEventColumn(updated, change.column, change.value)
+		if err != nil {
+			return err
+		}
+		history = append(history, &AuditEntry{eventID: event.id, userID: editorID, action: AuditEdit,
+			field: change.column, oldValue: oldValue, newValue: auditValue(change.value)})
+	}
+
+	*event = *updated
+	if editorID != "" {
+		for _, entry := range history {
+			store.audit(entry)
+		}
+	}
+	return nil
+}
+
+// Set an Event's field for an events column to a value meant for that column
+func setMemoryEventColumn(event *Event, columnName string, newValue interface{}) error {
+	var err error
+	switch columnName {
+	case "guild_id":
+		event.guildID, err = memoryString(newValue)
+	case "name":
+		event.name, err = memoryString(newValue)
+	case "description":
+		event.description, err = memoryString(newValue)
+	case "location":
+		event.location, err = memoryString(newValue)
+	case "timezone":
+		event.timezone, err = memoryString(newValue)
+	case "creator":
+		event.creator, err = memoryString(newValue)
+	case "creator_id":
+		event.creatorID, err = memoryString(newValue)
+	case "status":
+		event.status, err = memoryString(newValue)
+	case "announce_channel_id":
+		event.announceChannelID, err = memoryString(newValue)
+	case "announce_message_id":
+		event.announceMessageID, err = memoryString(newValue)
+	case "max_attendees":
+		event.maxAttendees, err = memoryInt(newValue)
+	case "starts_at":
+		var startsAt int64
+		startsAt, err = memoryInt(newValue)
+		event.startsAt = time.Unix(startsAt, 0).UTC()
+	case "recurrence":
+		var rule string
+		rule, err = memoryString(newValue)
+		if err == nil && rule == "" {
+			event.recurrence = nil
+		} else if err == nil {
+			event.recurrence, err = ParseRRule(rule, LoadTimezone(event.timezone))
+		}
+	default:
+		err = errors.New("events have no column " + columnName)
+	}
+	return err
+}
+
+// What an events column holds for an Event, as text
+func memoryEventColumn(event *Event, columnName string) string {
+	switch columnName {
+	case "name":
+		return event.name
+	case "description":
+		return event.description
+	case "location":
+		return event.location
+	case "max_attendees":
+		return strconv.FormatInt(event.maxAttendees, 10)
+	case "starts_at":
+		return strconv.FormatInt(event.startsAt.Unix(), 10)
+	case "recurrence":
+		if event.recurrence == nil {
+			return ""
+		}
+		return event.recurrence.String()
+	}
+	return ""
+}
+
+func (store *MemoryEventStore) CreateRSVP(eventID string, occurrence int64, username string, userID string,
+	status string) (*RSVP, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	status, err := store.applyCapacity(eventID, occurrence, 0, status)
+	if err != nil {
+		return nil, err
+	}
+
+	rsvp := memoryRSVP{RSVP{store.nextID(), eventID, occurrence, username, userID, status}, time.Now().UnixNano()}
+	store.rsvps = append(store.rsvps, &rsvp)
+	store.auditRSVP(&rsvp.RSVP, "", status)
+
+	copied := rsvp.RSVP
+	return &copied, nil
+}
+
+func (store *MemoryEventStore) UpdateRSVP(id string, status string) (*RSVP, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	var rsvp *memoryRSVP
+	for _, stored := range store.rsvps {
+		if strconv.FormatInt(stored.id, 10) == id {
+			rsvp = stored
+		}
+	}
+	if rsvp == nil {
+		return nil, sql.ErrNoRows
+	}
+
+	if rsvp.status == "Waitlisted" && status == "Going" {
+		// Already waiting for a spot, keep their place in line
+		copied := rsvp.RSVP
+		return &copied, nil
+	}
+
+	status, err := store.applyCapacity(rsvp.eventID, rsvp.occurrence, rsvp.id, status)
+	if err != nil {
+		return nil, err
+	}
+	if rsvp.status != "Waitlisted" {
+		rsvp.waitlistedAt = time.Now().UnixNano()
+	}
+	if status != rsvp.status {
+		store.auditRSVP(&rsvp.RSVP, rsvp.status, status)
+	}
+	rsvp.status = status
+
+	copied := rsvp.RSVP
+	return &copied, nil
+}
+
+// Return the status an RSVP should actually be stored with, given how many people are already going to the Event
+// The caller must hold the mutex
+func (store *MemoryEventStore) applyCapacity(eventID string, occurrence int64, rsvpID int64,
+	status string) (string, error) {
+	event, err := store.event(eventID)
+	if err != nil {
+		return "", err
+	}
+	if status != "Going" || event.maxAttendees == 0 {
+		return status, nil
+	}
+
+	if store.going(eventID, occurrence, rsvpID) >= event.maxAttendees {
+		return "Waitlisted", nil
+	}
+	return status, nil
+}
+
+// Count the people going to an Event, leaving out the RSVP with ID rsvpID
+// The caller must hold the mutex
+func (store *MemoryEventStore) going(eventID string, occurrence int64, rsvpID int64) int64 {
+	var going int64
+	for _, rsvp := range store.rsvps {
+		if rsvp.eventID == eventID && rsvp.occurrence == occurrence && rsvp.status == "Going" && rsvp.id != rsvpID {
+			going++
+		}
+	}
+	return going
+}
+
+func (store *MemoryEventStore) PromoteWaitlist(eventID string, occurrence int64) ([]*RSVP, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	event, err := store.event(eventID)
+	if err != nil {
+		return nil, err
+	}
+
+	var waitlist []*memoryRSVP
+	for _, rsvp := range store.rsvps {
+		if rsvp.eventID == eventID && rsvp.occurrence == occurrence && rsvp.status == "Waitlisted" {
+			waitlist = append(waitlist, rsvp)
+		}
+	}
+	sort.SliceStable(waitlist, func(i, j int) bool {
+		return waitlist[i].waitlistedAt < waitlist[j].waitlistedAt
+	})
+
+	openSpots := event.maxAttendees - store.going(eventID, occurrence, 0)
+	if event.maxAttendees == 0 {
+		openSpots = int64(len(waitlist)) // no limit, everyone on the waitlist gets in
+	}
+
+	var promoted []*RSVP
+	for _, rsvp := range waitlist {
+		if int64(len(promoted)) >= openSpots {
+			break
+		}
+		rsvp.status = "Going"
+		store.auditRSVP(&rsvp.RSVP, "Waitlisted", "Going")
+		copied := rsvp.RSVP
+		promoted = append(promoted, &copied)
+	}
+	return promoted, nil
+}
+
+func (store *MemoryEventStore) RetrieveRSVPs(eventID string, occurrence int64) ([]*RSVP, error) {
+	store.mutex.Lock()
+	_, err := store.event(eventID)
+	store.mutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	return store.findRSVPs(func(rsvp *RSVP) bool {
+		return rsvp.eventID == eventID && rsvp.occurrence == occurrence
+	}), nil
+}
+
+func (store *MemoryEventStore) RetrieveAllRSVPs(eventID string) ([]*RSVP, error) {
+	return store.findRSVPs(func(rsvp *RSVP) bool {
+		return rsvp.eventID == eventID
+	}), nil
+}
+
+func (store *MemoryEventStore) RetrieveUserRSVPs(userID string) ([]*RSVP, error) {
+	return store.findRSVPs(func(rsvp *RSVP) bool {
+		return rsvp.userID == userID && (rsvp.status == "Going" || rsvp.status == "Maybe")
+	}), nil
+}
+
+// Get copies of the RSVPs a function picks out, in the order they were created
+func (store *MemoryEventStore) findRSVPs(match func(rsvp *RSVP) bool) []*RSVP {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	var rsvps []*RSVP
+	for _, rsvp := range store.rsvps {
+		if match(&rsvp.RSVP) {
+			copied := rsvp.RSVP
+			rsvps = append(rsvps, &copied)
+		}
+	}
+	return rsvps
+}
+
+func (store *MemoryEventStore) RetrieveEventExceptions(eventID int64) (map[int64]*EventException, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	exceptions := make(map[int64]*EventException)
+	for occurrence, exception := range store.exceptions[eventID] {
+		copied := *exception
+		exceptions[occurrence] = &copied
+	}
+	return exceptions, nil
+}
+
+// Add someone RSVPing, or changing their RSVP, to an Event's history.  The caller must hold the mutex.
+func (store *MemoryEventStore) auditRSVP(rsvp *RSVP, oldStatus string, newStatus string) {
+	eventID, _ := strconv.ParseInt(rsvp.eventID, 10, 64)
+	store.audit(&AuditEntry{eventID: eventID, occurrence: rsvp.occurrence, userID: rsvp.userID, action: AuditRSVP,
+		oldValue: oldStatus, newValue: newStatus})
+}
+
+func (store *MemoryEventStore) UpdateOccurrenceColumns(eventID int64, occurrence int64, changes []ColumnChange,
+	editorID string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	// Make the changes to a copy so nothing is saved if any of them fail
+	exception := EventException{eventID: eventID, occurrence: occurrence}
+	if existing := store.exceptions[eventID][occurrence]; existing != nil {
+		exception = *existing
+	}
+	var history []*AuditEntry
+	for _, change := range changes {
+		oldValue := memoryOccurrenceColumn(store.events[eventID], &exception, change.column)
+		err := setMemoryExceptionColumn(&exception, change.column, change.value)
+		if err != nil {
+			return err
+		}
+		history = append(history, occurrenceAuditEntry(eventID, occurrence, editorID, change.column, oldValue,
+			change.value))
+	}
+
+	if store.exceptions[eventID] == nil {
+		store.exceptions[eventID] = make(map[int64]*EventException)
+	}
+	store.exceptions[eventID][occurrence] = &exception
+	if editorID != "" {
+		for _, entry := range history {
+			store.audit(entry)
+		}
+	}
+	return nil
+}
+
+// Set an EventException's field for an event_exceptions column to a value meant for that column
+func setMemoryExceptionColumn(exception *EventException, columnName string, newValue interface{}) error {
+	var err error
+	switch columnName {
+	case "cancelled":
+		var cancelled int64
+		cancelled, err = memoryInt(newValue)
+		exception.cancelled = cancelled != 0
+	case "starts_at":
+		var startsAt int64
+		startsAt, err = memoryInt(newValue)
+		exception.startsAt = time.Unix(startsAt, 0).UTC()
+	case "location":
+		exception.location, err = memoryString(newValue)
+	case "description":
+		exception.description, err = memoryString(newValue)
+	default:
+		err = errors.New("event exceptions have no column " + columnName)
+	}
+	return err
+}
+
+// What a column of one occurrence of a recurring Event holds, from its exception if it changed it and otherwise from
+// the series
+func memoryOccurrenceColumn(series *Event, exception *EventException, columnName string) string {
+	switch columnName {
+	case "cancelled":
+		if exception.cancelled {
+			return "1"
+		}
+		return "0"
+	case "starts_at":
+		if !exception.startsAt.IsZero() {
+			return strconv.FormatInt(exception.startsAt.Unix(), 10)
+		}
+		return strconv.FormatInt(exception.occurrence, 10)
+	case "location":
+		if exception.location != "" || series == nil {
+			return exception.location
+		}
+	case "description":
+		if exception.description != "" || series == nil {
+			return exception.description
+		}
+	}
+	if series == nil {
+		return ""
+	}
+	return memoryEventColumn(series, columnName)
+}
+
+func (store *MemoryEventStore) RetrieveHistory(eventID int64, limit int) ([]*AuditEntry, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	var history []*AuditEntry
+	for i := len(store.history) - 1; i >= 0 && len(history) < limit; i-- {
+		if store.history[i].eventID == eventID {
+			copied := *store.history[i]
+			history = append([]*AuditEntry{&copied}, history...)
+		}
+	}
+	return history, nil
+}
+
+func (store *MemoryEventStore) ReplaceReminders(eventID int64, occurrence int64, remindAt []time.Time) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	id := strconv.FormatInt(eventID, 10)
+	for reminderID, reminder := range store.reminders {
+		if reminder.eventID == id {
+			delete(store.reminders, reminderID)
+		}
+	}
+	for _, t := range remindAt {
+		reminder := Reminder{store.nextID(), id, occurrence, time.Unix(t.Unix(), 0).UTC()}
+		store.reminders[reminder.id] = &reminder
+	}
+	return nil
+}
+
+func (store *MemoryEventStore) RetrieveDueReminders(now time.Time) ([]*Reminder, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	var reminders []*Reminder
+	for _, reminder := range store.reminders {
+		if !reminder.remindAt.After(now) {
+			copied := *reminder
+			reminders = append(reminders, &copied)
+		}
+	}
+	sort.Slice(reminders, func(i, j int) bool {
+		if reminders[i].remindAt.Equal(reminders[j].remindAt) {
+			return reminders[i].id < reminders[j].id
+		}
+		return reminders[i].remindAt.Before(reminders[j].remindAt)
+	})
+	return reminders, nil
+}
+
+func (store *MemoryEventStore) DeleteReminder(id int64) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	delete(store.reminders, id)
+	return nil
+}
+
+func (store *MemoryEventStore) AddCohost(eventID int64, userID string, addedBy string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	for _, cohost := range store.cohosts[eventID] {
+		if cohost == userID {
+			return nil
+		}
+	}
+	store.cohosts[eventID] = append(store.cohosts[eventID], userID)
+	store.audit(&AuditEntry{eventID: eventID, userID: addedBy, action: AuditCohost, newValue: userID})
+	return nil
+}
+
+func (store *MemoryEventStore) RemoveCohost(eventID int64, userID string, removedBy string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if store.removeCohost(eventID, userID) {
+		store.audit(&AuditEntry{eventID: eventID, userID: removedBy, action: AuditCohost, oldValue: userID})
+	}
+	return nil
+}
+
+// Stop a user co-hosting an Event, returning whether they did.  The caller must hold the mutex.
+func (store *MemoryEventStore) removeCohost(eventID int64, userID string) bool {
+	var remaining []string
+	for _, cohost := range store.cohosts[eventID] {
+		if cohost != userID {
+			remaining = append(remaining, cohost)
+		}
+	}
+	removed := len(remaining) != len(store.cohosts[eventID])
+	store.cohosts[eventID] = remaining
+	return removed
+}
+
+func (store *MemoryEventStore) TransferEvent(eventID int64, creator string, creatorID string,
+	transferredBy string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	event, ok := store.events[eventID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	store.audit(&AuditEntry{eventID: eventID, userID: transferredBy, action: AuditEdit, field: "creator_id",
+		oldValue: event.creatorID, newValue: creatorID})
+	event.creator = creator
+	event.creatorID = creatorID
+	store.removeCohost(eventID, creatorID)
+	return nil
+}
+
+func (store *MemoryEventStore) RetrieveCohosts(eventID int64) ([]string, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	return append([]string(nil), store.cohosts[eventID]...), nil
+}
+
+func (store *MemoryEventStore) RetrieveGuildSetting(guildID string, columnName string) (string, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	return store.guildSettings[guildID][columnName], nil
+}
+
+func (store *MemoryEventStore) UpdateGuildSetting(guildID string, columnName string, value string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if store.guildSettings[guildID] == nil {
+		store.guildSettings[guildID] = make(map[string]string)
+	}
+	store.guildSettings[guildID][columnName] = value
+	return nil
+}
+
+// Read a value meant for a TEXT column
+func memoryString(value interface{}) (string, error) {
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	return "", fmt.Errorf("expected text but got %v", value)
+}
+
+// Read a value meant for an INTEGER column
+func memoryInt(value interface{}) (int64, error) {
+	switch n := value.(type) {
+	case int:
+		return int64(n), nil
+	case int64:
+		return n, nil
+	case bool:
+		if n {
+			return 1, nil
+		}
+		return 0, nil
+	}
+	return 0, fmt.Errorf("expected an integer but got %v", value)
+}
+
+// A MessageStore that keeps messages in memory, for tests and for trying the bot out without a database
+type MemoryMessageStore struct {
+	mutex     sync.Mutex
+	messages  []Message
+	penalties []Penalty
+	incidents []RepostIncident
+	lastID    int64
+}
+
+func NewMemoryMessageStore() *MemoryMessageStore {
+	return &MemoryMessageStore{}
+}
+
+func (store *MemoryMessageStore) RecordMessage(message *Message) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	store.messages = append(store.messages, *message)
+	return nil
+}
+
+func (store *MemoryMessageStore) DetectRepost(guildID string, urls []string, since time.Time) (*Message, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	for _, recorded := range store.messages {
+		if recorded.guildID != guildID || recorded.postedAt.Before(since) {
+			continue
+		}
+		for _, recordedURL := range recorded.urls {
+			for _, url := range urls {
+				if recordedURL == url {
+					original := recorded
+					return &original, nil
+				}
+			}
+		}
+	}
+	return nil, nil
+}
+
+func (store *MemoryMessageStore) DetectImageRepost(guildID string, hashes []uint64, maxDistance int,
+	since time.Time) (*Message, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	// Like the SQL store, only compare the most recent images, keeping the earliest match among them
+	var original *Message
+	compared := 0
+	for i := len(store.messages) - 1; i >= 0 && compared < maxComparedImages; i-- {
+		recorded := store.messages[i]
+		if recorded.guildID != guildID || recorded.postedAt.Before(since) {
+			continue
+		}
+		for _, recordedHash := range recorded.imageHashes {
+			compared++
+			for _, hash := range hashes {
+				if HashDistance(recordedHash, hash) <= maxDistance {
+					original = &recorded
+				}
+			}
+		}
+	}
+	return original, nil
+}
+
+func (store *MemoryMessageStore) AssignUnscopedMessages(guildID string) (int64, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	var moved int64
+	for i := range store.messages {
+		if store.messages[i].guildID == "" {
+			store.messages[i].guildID = guildID
+			moved++
+		}
+	}
+	return moved, nil
+}
+
+func (store *MemoryMessageStore) CreatePenalty(penalty *Penalty) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	store.lastID++
+	penalty.id = store.lastID
+	store.penalties = append(store.penalties, *penalty)
+	return nil
+}
+
+func (store *MemoryMessageStore) RetrievePenalty(guildID string, userID string, now time.Time) (*Penalty, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	var active *Penalty
+	for i, penalty := range store.penalties {
+		if penalty.guildID == guildID && penalty.userID == userID && penalty.expiresAt.After(now) &&
+			(active == nil || penalty.expiresAt.After(active.expiresAt)) {
+			active = &store.penalties[i]
+		}
+	}
+	if active == nil {
+		return nil, nil
+	}
+	penalty := *active
+	return &penalty, nil
+}
+
+func (store *MemoryMessageStore) LiftPenalties(guildID string, userID string, now time.Time) (int64, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	var lifted int64
+	remaining := store.penalties[:0]
+	for _, penalty := range store.penalties {
+		if penalty.guildID == guildID && penalty.userID == userID && penalty.expiresAt.After(now) {
+			lifted++
+			continue
+		}
+		remaining = append(remaining, penalty)
+	}
+	store.penalties = remaining
+	return lifted, nil
+}
+
+func (store *MemoryMessageStore) RecordRepost(incident *RepostIncident) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	store.incidents = append(store.incidents, *incident)
+	return nil
+}
+
+func (store *MemoryMessageStore) RetrieveRepostStats(guildID string, userID string, since time.Time,
+	limit int) (*RepostStats, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	var stats RepostStats
+	byUser := make(map[string]int64)
+	byLink := make(map[string]int64)
+	for _, incident := range store.incidents {
+		if incident.guildID != guildID || incident.repostedAt.Before(since) {
+			continue
+		}
+		byUser[incident.userID]++
+		if incident.url != "" {
+			byLink[incident.url]++
+		}
+		if incident.userID == userID {
+			stats.userReposts++
+		}
+	}
+	for _, message := range store.messages {
+		if message.guildID == guildID && message.authorID == userID && !message.postedAt.Before(since) {
+			stats.userMessages++
+		}
+	}
+
+	stats.topReposters = topRepostCounts(byUser, limit)
+	stats.topLinks = topRepostCounts(byLink, limit)
+	return &stats, nil
+}
+
+// Sort counts by most reposts, then by key, keeping the first limit of them
+func topRepostCounts(counts map[string]int64, limit int) []RepostCount {
+	var sorted []RepostCount
+	for key, count := range counts {
+		sorted = append(sorted, RepostCount{key, count})
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].count != sorted[j].count {
+			return sorted[i].count > sorted[j].count
+		}
+		return sorted[i].key < sorted[j].key
+	})
+	if len(sorted) > limit {
+		sorted = sorted[:limit]
+	}
+	return sorted
+}
@@ -2,57 +2,228 @@ package main
 
 import (
 	"database/sql"
-	_ "github.com/mattn/go-sqlite3"
 	"strings"
+	"time"
 )
 
-var (
-	messageDB *sql.DB = OpenDB("./db/messages.sqlite")
-)
+// A MessageStore backed by SQLite or PostgreSQL
+type SQLMessageStore struct {
+	*sqlDB
+}
 
-func RecordMessage(authorID string, message string) error {
-	stmt, err := messageDB.Prepare(`INSERT INTO messages (author_id, message) VALUES (?,?)`)
+// A Message is something posted in a guild, recorded so later posts of the same links or images can be caught
+type Message struct {
+	guildID          string
+	channelID        string
+	discordMessageID string
+	authorID         string
+	content          string
+	postedAt         time.Time // zero for messages recorded before this was kept
+	urls             []string  // canonical forms of the links in the message
+	imageHashes      []uint64  // perceptual hashes of the images attached to the message
+}
+
+// A link to jump to a Message in Discord
+func (message *Message) Link() string {
+	return "https://discord.com/channels/" + message.guildID + "/" + message.channelID + "/" + message.discordMessageID
+}
+
+// Record a message along with the canonical forms of the links in it and the hashes of its images
+func (store *SQLMessageStore) RecordMessage(message *Message) error {
+	stmt, err := store.prepareInsert(`INSERT INTO messages (guild_id, channel_id, discord_message_id, author_id, message,
+        posted_at) VALUES (?,?,?,?,?,?)`)
+	if err != nil {
+		return err
+	}
+	linkStmt, err := store.prepare(`INSERT INTO message_links (message_id, guild_id, url) VALUES (?,?,?)`)
+	if err != nil {
+		return err
+	}
+	imageStmt, err := store.prepare(`INSERT INTO message_images (message_id, guild_id, hash, posted_at) VALUES (?,?,?,?)`)
 	if err != nil {
 		return err
 	}
 
-	tx, err := messageDB.Begin()
+	tx, err := store.db.Begin()
 	if err != nil {
 		return err
 	}
 
-	_, err = tx.Stmt(stmt).Exec(authorID, message)
+	id, err := store.insert(tx, stmt, message.guildID, message.channelID, message.discordMessageID, message.authorID,
+		message.content, message.postedAt.Unix())
 	if err != nil {
 		tx.Rollback()
 		return err
 	}
+	for _, url := range message.urls {
+		_, err = tx.Stmt(linkStmt).Exec(id, message.guildID, url)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	for _, hash := range message.imageHashes {
+		// Hashes use all 64 bits, so they are stored as signed integers
+		_, err = tx.Stmt(imageStmt).Exec(id, message.guildID, int64(hash), message.postedAt.Unix())
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
 
-	tx.Commit()
-	return nil
+	return tx.Commit()
 }
 
-func DetectRepost(message string) (bool, error) {
-	stmt, err := messageDB.Prepare(`SELECT message FROM messages WHERE message = ?`)
+// Find the first message in a guild since a time that posted any of the links in a message, in their canonical forms
+// Returns nil if none of the links have been posted since then
+func (store *SQLMessageStore) DetectRepost(guildID string, urls []string, since time.Time) (*Message, error) {
+	if len(urls) == 0 {
+		return nil, nil
+	}
+
+	args := []interface{}{guildID}
+	for _, url := range urls {
+		args = append(args, url)
+	}
+	args = append(args, since.Unix())
+	stmt, err := store.prepare(`SELECT message_links.message_id FROM message_links
+        JOIN messages ON messages.id = message_links.message_id
+        WHERE message_links.guild_id = ? AND message_links.url IN (?` + strings.Repeat(`, ?`, len(urls)-1) + `)
+        AND messages.posted_at >= ? ORDER BY message_links.message_id LIMIT 1`)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 
-	result, err := stmt.Query(message)
+	var originalID int64
+	err = stmt.QueryRow(args...).Scan(&originalID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return store.retrieveMessage(originalID)
+}
+
+// Find the first message in a guild since a time with an image whose hash is within maxDistance bits of one of hashes
+// Returns nil if none of the images have been posted since then.  Only the most recent maxComparedImages images are
+// compared, so a guild that never lets images be reposted doesn't compare against every image it has ever seen.
+func (store *SQLMessageStore) DetectImageRepost(guildID string, hashes []uint64, maxDistance int,
+	since time.Time) (*Message, error) {
+	if len(hashes) == 0 {
+		return nil, nil
+	}
 
+	// Hashes can't be compared by distance in SQL, but there is only one row per image and a hash is small
+	stmt, err := store.prepare(`SELECT message_id, hash FROM message_images WHERE guild_id = ? AND posted_at >= ?
+        ORDER BY id DESC LIMIT ?`)
 	if err != nil {
-		return false, err
+		return nil, err
+	}
+	result, err := stmt.Query(guildID, since.Unix(), maxComparedImages)
+	if err != nil {
+		return nil, err
 	}
 
+	// The most recent images come first, so the last match is the first time the image was posted
+	var originalID int64
 	defer result.Close()
 	for result.Next() {
-		var m string
-		err := result.Scan(&m)
+		var messageID, hash int64
+		err := result.Scan(&messageID, &hash)
 		if err != nil {
-			return false, err
+			return nil, err
 		}
-		if strings.Compare(message, m) == 0 {
-			return true, nil
+		for _, h := range hashes {
+			if HashDistance(uint64(hash), h) <= maxDistance {
+				originalID = messageID
+			}
+		}
+	}
+	err = result.Err()
+	result.Close()
+	if err != nil || originalID == 0 {
+		return nil, err
+	}
+
+	return store.retrieveMessage(originalID)
+}
+
+// Get a recorded message with the canonical forms of its links, but not its image hashes
+func (store *SQLMessageStore) retrieveMessage(id int64) (*Message, error) {
+	stmt, err := store.prepare(`SELECT guild_id, channel_id, discord_message_id, author_id, message, posted_at
+        FROM messages WHERE id = ?`)
+	if err != nil {
+		return nil, err
+	}
+
+	var message Message
+	var postedAt int64
+	err = stmt.QueryRow(id).Scan(&message.guildID, &message.channelID, &message.discordMessageID, &message.authorID,
+		&message.content, &postedAt)
+	if err != nil {
+		return nil, err
+	}
+	if postedAt != 0 {
+		message.postedAt = time.Unix(postedAt, 0)
+	}
+
+	linkStmt, err := store.prepare(`SELECT url FROM message_links WHERE message_id = ? ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	result, err := linkStmt.Query(id)
+	if err != nil {
+		return nil, err
+	}
+	defer result.Close()
+	for result.Next() {
+		var url string
+		err = result.Scan(&url)
+		if err != nil {
+			return nil, err
 		}
+		message.urls = append(message.urls, url)
+	}
+	return &message, result.Err()
+}
+
+// Move messages recorded before messages were scoped to guilds into a guild
+// Returns how many messages were moved
+func (store *SQLMessageStore) AssignUnscopedMessages(guildID string) (int64, error) {
+	stmt, err := store.prepare(`UPDATE messages SET guild_id = ? WHERE guild_id = ''`)
+	if err != nil {
+		return 0, err
 	}
-	return false, nil
-}
\ No newline at end of file
+	linkStmt, err := store.prepare(`UPDATE message_links SET guild_id = ? WHERE guild_id = ''`)
+	if err != nil {
+		return 0, err
+	}
+	imageStmt, err := store.prepare(`UPDATE message_images SET guild_id = ? WHERE guild_id = ''`)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := store.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := tx.Stmt(stmt).Exec(guildID)
+	if err == nil {
+		_, err = tx.Stmt(linkStmt).Exec(guildID)
+	}
+	if err == nil {
+		_, err = tx.Stmt(imageStmt).Exec(guildID)
+	}
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
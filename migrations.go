@@ -0,0 +1,437 @@
+package main
+
+import (
+	"database/sql"
+	"embed"
+	"errors"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schema changes for each database, in migrations/<sqlite or postgres>/<database>/<version>_<name>.sql
+// Versions mean the same schema on both, so a migration added for one needs an equivalent for the other
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+// A Migration moves a database's schema from the previous version to this one
+// Most are SQL files, but changes SQL can't express, like converting values, are written in Go.  A version with both
+// runs its SQL first.
+type Migration struct {
+	version int
+	name    string
+	sql     string
+	up      func(store *sqlDB, tx *sql.Tx) error
+}
+
+// Migrations written in Go, by the directory their SQL migrations are in
+var goMigrations = map[string][]Migration{
+	"sqlite/events": {
+		{version: 2, name: "upgrade_original_schema", up: upgradeOriginalEventsSchema},
+	},
+	"sqlite/messages": {
+		{version: 2, name: "guild_ids", up: addMessageGuildIDs},
+		{version: 3, up: backfillMessageLinks},
+	},
+	"postgres/messages": {
+		{version: 3, up: backfillMessageLinks},
+	},
+}
+
+// Bring a database up to the latest version of its schema, creating it from scratch if it is empty.
+// Refuses to touch a database that is at a newer version than this build knows about.
+func (store *sqlDB) migrate(dbName string) error {
+	dialect := "sqlite"
+	if store.driver == "postgres" {
+		dialect = "postgres"
+	}
+	migrations, err := loadMigrations(path.Join(dialect, dbName))
+	if err != nil {
+		return err
+	}
+
+	db := store.db
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations
+        (version INTEGER PRIMARY KEY, name TEXT NOT NULL, applied_at INTEGER NOT NULL)`)
+	if err != nil {
+		return err
+	}
+
+	var current int
+	err = db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current)
+	if err != nil {
+		return err
+	}
+
+	if current == 0 && dialect == "sqlite" {
+		// Databases created by hand from the old scripts already have the original schema
+		var tables int
+		err = db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name NOT LIKE 'sqlite_%'
+            AND name<>'schema_migrations'`).Scan(&tables)
+		if err != nil {
+			return err
+		}
+		if tables > 0 {
+			_, err = db.Exec(store.rebind(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`),
+				migrations[0].version, migrations[0].name, time.Now().Unix())
+			if err != nil {
+				return err
+			}
+			current = migrations[0].version
+		}
+	}
+
+	latest := migrations[len(migrations)-1].version
+	if current > latest {
+		return errors.New("the " + dbName + " database is at schema version " + strconv.Itoa(current) +
+			" but this build only knows up to version " + strconv.Itoa(latest) + ", refusing to start")
+	}
+
+	for _, migration := range migrations {
+		if migration.version <= current {
+			continue
+		}
+		err = store.applyMigration(migration)
+		if err != nil {
+			return errors.New("migrating the " + dbName + " database to version " +
+				strconv.Itoa(migration.version) + " (" + migration.name + "): " + err.Error())
+		}
+	}
+	return nil
+}
+
+// Apply a single migration and record it, all in one transaction
+func (store *sqlDB) applyMigration(migration Migration) error {
+	tx, err := store.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if migration.sql != "" {
+		_, err = tx.Exec(migration.sql)
+	}
+	if err == nil && migration.up != nil {
+		err = migration.up(store, tx)
+	}
+	if err == nil {
+		_, err = tx.Exec(store.rebind(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`),
+			migration.version, migration.name, time.Now().Unix())
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Get the migrations in a directory in order, checking there is exactly one for every version from the first
+func loadMigrations(migrationsDir string) ([]Migration, error) {
+	migrations := append([]Migration{}, goMigrations[migrationsDir]...)
+
+	dir := path.Join("migrations", migrationsDir)
+	files, err := migrationFiles.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		if !strings.HasSuffix(file.Name(), ".sql") {
+			continue
+		}
+		versionName := strings.SplitN(strings.TrimSuffix(file.Name(), ".sql"), "_", 2)
+		version, err := strconv.Atoi(versionName[0])
+		if err != nil || len(versionName) != 2 {
+			return nil, errors.New("badly named migration " + path.Join(dir, file.Name()))
+		}
+		contents, err := migrationFiles.ReadFile(path.Join(dir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		merged := false
+		for i := range migrations {
+			if migrations[i].version == version && migrations[i].sql == "" {
+				migrations[i].name = versionName[1]
+				migrations[i].sql = string(contents)
+				merged = true
+			}
+		}
+		if !merged {
+			migrations = append(migrations, Migration{version: version, name: versionName[1], sql: string(contents)})
+		}
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].version < migrations[j].version
+	})
+	if len(migrations) == 0 {
+		return nil, errors.New("there are no migrations in " + dir)
+	}
+	for i, migration := range migrations {
+		if migration.version != migrations[0].version+i {
+			return nil, errors.New("the migrations in " + dir + " skip or repeat version " +
+				strconv.Itoa(migrations[0].version+i))
+		}
+	}
+	return migrations, nil
+}
+
+// Get the names of a table's columns, or an empty set if the table doesn't exist
+func tableColumns(tx *sql.Tx, table string) (map[string]bool, error) {
+	result, err := tx.Query(`PRAGMA table_info(` + table + `)`)
+	if err != nil {
+		return nil, err
+	}
+	defer result.Close()
+
+	columnNames, err := result.Columns()
+	if err != nil {
+		return nil, err
+	}
+	columns := make(map[string]bool)
+	for result.Next() {
+		values := make([]interface{}, len(columnNames))
+		pointers := make([]interface{}, len(columnNames))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		err = result.Scan(pointers...)
+		if err != nil {
+			return nil, err
+		}
+		for i, columnName := range columnNames {
+			if columnName == "name" {
+				name, _ := values[i].(string)
+				if bytes, ok := values[i].([]byte); ok {
+					name = string(bytes)
+				}
+				columns[name] = true
+			}
+		}
+	}
+	return columns, result.Err()
+}
+
+// Add each of the columns to a table that it doesn't already have
+// Definitions are in the order they should be added, like {"guild_id", "TEXT NOT NULL"}
+func addMissingColumns(tx *sql.Tx, table string, definitions [][2]string) error {
+	columns, err := tableColumns(tx, table)
+	if err != nil {
+		return err
+	}
+	for _, definition := range definitions {
+		if columns[definition[0]] {
+			continue
+		}
+		_, err = tx.Exec(`ALTER TABLE ` + table + ` ADD COLUMN ` + definition[0] + ` ` + definition[1])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Upgrade the original events schema, where dates and times were free text, to timestamped Events with RSVPs,
+// reminders, recurrence and guild settings.  Databases that were created by hand from any later version of the old
+// scripts are upgraded too, since their missing columns and tables are added the same way.
+func upgradeOriginalEventsSchema(store *sqlDB, tx *sql.Tx) error {
+	columns, err := tableColumns(tx, "events")
+	if err != nil {
+		return err
+	}
+
+	if columns["event_date"] {
+		err = convertEventDates(tx)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = addMissingColumns(tx, "events", [][2]string{
+		{"guild_id", "TEXT NOT NULL DEFAULT ''"},
+		{"starts_at", "INTEGER NOT NULL DEFAULT 0"},
+		{"timezone", "TEXT NOT NULL DEFAULT ''"},
+		{"max_attendees", "INTEGER NOT NULL DEFAULT 0"},
+		{"recurrence", "TEXT NOT NULL DEFAULT ''"},
+		{"announce_channel_id", "TEXT NOT NULL DEFAULT ''"},
+		{"announce_message_id", "TEXT NOT NULL DEFAULT ''"},
+	})
+	if err != nil {
+		return err
+	}
+	err = addMissingColumns(tx, "rsvps", [][2]string{
+		{"occurrence", "INTEGER NOT NULL DEFAULT 0"},
+		{"waitlisted_at", "INTEGER NOT NULL DEFAULT 0"},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+CREATE TABLE IF NOT EXISTS guild_settings
+(
+    guild_id TEXT PRIMARY KEY,
+    timezone TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS reminders
+(
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    event_id INTEGER NOT NULL,
+    occurrence INTEGER NOT NULL DEFAULT 0,
+    remind_at INTEGER NOT NULL,
+    FOREIGN KEY (event_id) REFERENCES events (id)
+);
+
+CREATE TABLE IF NOT EXISTS event_exceptions
+(
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    event_id INTEGER NOT NULL,
+    occurrence INTEGER NOT NULL,
+    cancelled INTEGER NOT NULL DEFAULT 0,
+    starts_at INTEGER,
+    location TEXT,
+    description TEXT,
+    UNIQUE (event_id, occurrence),
+    FOREIGN KEY (event_id) REFERENCES events (id)
+);`)
+	if err != nil {
+		return err
+	}
+	err = addMissingColumns(tx, "guild_settings", [][2]string{
+		{"announce_channel_id", "TEXT NOT NULL DEFAULT ''"},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+CREATE INDEX IF NOT EXISTS events_starts_at ON events (starts_at);
+CREATE INDEX IF NOT EXISTS events_guild_id ON events (guild_id, starts_at);
+CREATE INDEX IF NOT EXISTS events_announce_message_id ON events (announce_message_id);
+CREATE INDEX IF NOT EXISTS reminders_remind_at ON reminders (remind_at);`)
+	return err
+}
+
+// Rebuild the original events table without its free text date and time columns, converting them to a start time
+// in the default timezone.  Dates that can't be understood are kept in the Event's description instead.
+func convertEventDates(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+CREATE TABLE events_upgraded
+(
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    description TEXT NOT NULL,
+    location TEXT NOT NULL,
+    starts_at INTEGER NOT NULL,
+    timezone TEXT NOT NULL,
+    creator TEXT NOT NULL,
+    creator_id TEXT NOT NULL
+)`)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Query(`SELECT id, name, description, location, event_date, event_time, creator, creator_id
+        FROM events`)
+	if err != nil {
+		return err
+	}
+	type legacyEvent struct {
+		id                                                int64
+		name, description, location, eventDate, eventTime string
+		creator, creatorID                                string
+	}
+	var events []legacyEvent
+	for result.Next() {
+		var event legacyEvent
+		err = result.Scan(&event.id, &event.name, &event.description, &event.location, &event.eventDate,
+			&event.eventTime, &event.creator, &event.creatorID)
+		if err != nil {
+			result.Close()
+			return err
+		}
+		events = append(events, event)
+	}
+	result.Close()
+	if err = result.Err(); err != nil {
+		return err
+	}
+
+	loc := LoadTimezone("")
+	for _, event := range events {
+		description := event.description
+		startsAt, err := ParseEventDateTime(event.eventDate+" "+event.eventTime, loc, time.Now())
+		if err != nil {
+			startsAt = time.Unix(0, 0)
+			description += "\n*Originally planned for:* " + event.eventDate + " " + event.eventTime
+		}
+		_, err = tx.Exec(`INSERT INTO events_upgraded (id, name, description, location, starts_at, timezone, creator,
+            creator_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, event.id, event.name, description, event.location,
+			startsAt.Unix(), loc.String(), event.creator, event.creatorID)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(`DROP TABLE events; ALTER TABLE events_upgraded RENAME TO events;`)
+	return err
+}
+
+// Scope messages to guilds.  Existing messages are left without one until they are assigned with -legacy-guild.
+func addMessageGuildIDs(store *sqlDB, tx *sql.Tx) error {
+	err := addMissingColumns(tx, "messages", [][2]string{
+		{"guild_id", "TEXT NOT NULL DEFAULT ''"},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`CREATE INDEX IF NOT EXISTS messages_guild_id ON messages (guild_id, message)`)
+	return err
+}
+
+// Record the links in messages posted before links were compared in their canonical forms
+func backfillMessageLinks(store *sqlDB, tx *sql.Tx) error {
+	result, err := tx.Query(`SELECT id, guild_id, message FROM messages`)
+	if err != nil {
+		return err
+	}
+	type message struct {
+		id      int64
+		guildID string
+		urls    []string
+	}
+	var messages []message
+	for result.Next() {
+		var m message
+		var content string
+		err = result.Scan(&m.id, &m.guildID, &content)
+		if err != nil {
+			result.Close()
+			return err
+		}
+		m.urls = CanonicalURLs(content)
+		if len(m.urls) > 0 {
+			messages = append(messages, m)
+		}
+	}
+	result.Close()
+	if err = result.Err(); err != nil {
+		return err
+	}
+
+	for _, m := range messages {
+		for _, url := range m.urls {
+			_, err = tx.Exec(store.rebind(`INSERT INTO message_links (message_id, guild_id, url) VALUES (?, ?, ?)`),
+				m.id, m.guildID, url)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+-- PostgreSQL databases start out at the same schema version 2 that SQLite databases are upgraded to
+
+CREATE TABLE events
+(
+    id BIGSERIAL PRIMARY KEY,
+    guild_id TEXT NOT NULL DEFAULT '',
+    name TEXT NOT NULL,
+    description TEXT NOT NULL,
+    location TEXT NOT NULL,
+    starts_at BIGINT NOT NULL,
+    timezone TEXT NOT NULL,
+    max_attendees BIGINT NOT NULL DEFAULT 0,
+    recurrence TEXT NOT NULL DEFAULT '',
+    creator TEXT NOT NULL,
+    creator_id TEXT NOT NULL,
+    announce_channel_id TEXT NOT NULL DEFAULT '',
+    announce_message_id TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX events_starts_at ON events (starts_at);
+CREATE INDEX events_guild_id ON events (guild_id, starts_at);
+CREATE INDEX events_announce_message_id ON events (announce_message_id);
+
+CREATE TABLE rsvps
+(
+    id BIGSERIAL PRIMARY KEY,
+    event_id BIGINT NOT NULL REFERENCES events (id) ON DELETE CASCADE,
+    occurrence BIGINT NOT NULL DEFAULT 0,
+    username TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    status TEXT NOT NULL,
+    waitlisted_at BIGINT NOT NULL DEFAULT 0
+);
+
+CREATE TABLE guild_settings
+(
+    guild_id TEXT PRIMARY KEY,
+    timezone TEXT NOT NULL DEFAULT '',
+    announce_channel_id TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE reminders
+(
+    id BIGSERIAL PRIMARY KEY,
+    event_id BIGINT NOT NULL REFERENCES events (id) ON DELETE CASCADE,
+    occurrence BIGINT NOT NULL DEFAULT 0,
+    remind_at BIGINT NOT NULL
+);
+
+CREATE INDEX reminders_remind_at ON reminders (remind_at);
+
+CREATE TABLE event_exceptions
+(
+    id BIGSERIAL PRIMARY KEY,
+    event_id BIGINT NOT NULL REFERENCES events (id) ON DELETE CASCADE,
+    occurrence BIGINT NOT NULL,
+    cancelled INTEGER NOT NULL DEFAULT 0,
+    starts_at BIGINT,
+    location TEXT,
+    description TEXT,
+    UNIQUE (event_id, occurrence)
+);
@@ -0,0 +1,4 @@
+ALTER TABLE guild_settings ADD COLUMN repost_ignored_channels TEXT NOT NULL DEFAULT '';
+ALTER TABLE guild_settings ADD COLUMN repost_exempt_roles TEXT NOT NULL DEFAULT '';
+ALTER TABLE guild_settings ADD COLUMN repost_allowed_domains TEXT NOT NULL DEFAULT '';
+ALTER TABLE guild_settings ADD COLUMN repost_window TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,10 @@
+CREATE TABLE event_cohosts
+(
+    id BIGSERIAL PRIMARY KEY,
+    event_id BIGINT NOT NULL REFERENCES events (id) ON DELETE CASCADE,
+    user_id TEXT NOT NULL
+);
+
+CREATE UNIQUE INDEX event_cohosts_event_id_user_id ON event_cohosts (event_id, user_id);
+
+ALTER TABLE guild_settings ADD COLUMN event_manager_roles TEXT NOT NULL DEFAULT '';
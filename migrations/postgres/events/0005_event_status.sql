@@ -0,0 +1,5 @@
+ALTER TABLE events ADD COLUMN status TEXT NOT NULL DEFAULT 'scheduled';
+ALTER TABLE events ADD COLUMN cancel_reason TEXT NOT NULL DEFAULT '';
+ALTER TABLE events ADD COLUMN cancelled_at BIGINT NOT NULL DEFAULT 0;
+
+CREATE INDEX events_status ON events (guild_id, status);
@@ -0,0 +1,14 @@
+CREATE TABLE event_audit
+(
+    id BIGSERIAL PRIMARY KEY,
+    event_id BIGINT NOT NULL REFERENCES events (id) ON DELETE CASCADE,
+    occurrence BIGINT NOT NULL DEFAULT 0,
+    user_id TEXT NOT NULL,
+    action TEXT NOT NULL,
+    field TEXT NOT NULL DEFAULT '',
+    old_value TEXT NOT NULL DEFAULT '',
+    new_value TEXT NOT NULL DEFAULT '',
+    changed_at BIGINT NOT NULL
+);
+
+CREATE INDEX event_audit_event_id ON event_audit (event_id);
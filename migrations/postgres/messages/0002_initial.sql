@@ -0,0 +1,11 @@
+-- PostgreSQL databases start out at the same schema version 2 that SQLite databases are upgraded to
+
+CREATE TABLE messages
+(
+    id BIGSERIAL PRIMARY KEY,
+    guild_id TEXT NOT NULL DEFAULT '',
+    author_id TEXT NOT NULL,
+    message TEXT NOT NULL
+);
+
+CREATE INDEX messages_guild_id ON messages (guild_id, message);
@@ -0,0 +1,9 @@
+CREATE TABLE message_links
+(
+    id BIGSERIAL PRIMARY KEY,
+    message_id BIGINT NOT NULL REFERENCES messages (id) ON DELETE CASCADE,
+    guild_id TEXT NOT NULL,
+    url TEXT NOT NULL
+);
+
+CREATE INDEX message_links_guild_id_url ON message_links (guild_id, url);
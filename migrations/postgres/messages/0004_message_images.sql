@@ -0,0 +1,12 @@
+ALTER TABLE messages ADD COLUMN channel_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE messages ADD COLUMN discord_message_id TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE message_images
+(
+    id BIGSERIAL PRIMARY KEY,
+    message_id BIGINT NOT NULL REFERENCES messages (id) ON DELETE CASCADE,
+    guild_id TEXT NOT NULL,
+    hash BIGINT NOT NULL
+);
+
+CREATE INDEX message_images_guild_id ON message_images (guild_id);
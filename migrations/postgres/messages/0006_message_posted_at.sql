@@ -0,0 +1 @@
+ALTER TABLE messages ADD COLUMN posted_at BIGINT NOT NULL DEFAULT 0;
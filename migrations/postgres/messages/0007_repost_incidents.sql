@@ -0,0 +1,13 @@
+CREATE TABLE repost_incidents
+(
+    id BIGSERIAL PRIMARY KEY,
+    guild_id TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    channel_id TEXT NOT NULL,
+    discord_message_id TEXT NOT NULL,
+    original_author_id TEXT NOT NULL,
+    url TEXT NOT NULL,
+    reposted_at BIGINT NOT NULL
+);
+
+CREATE INDEX repost_incidents_guild_id ON repost_incidents (guild_id, reposted_at);
@@ -0,0 +1,6 @@
+ALTER TABLE message_images ADD COLUMN posted_at BIGINT NOT NULL DEFAULT 0;
+
+UPDATE message_images SET posted_at = messages.posted_at FROM messages WHERE messages.id = message_images.message_id;
+
+DROP INDEX message_images_guild_id;
+CREATE INDEX message_images_guild_id ON message_images (guild_id, posted_at);
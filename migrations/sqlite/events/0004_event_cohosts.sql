@@ -0,0 +1,11 @@
+CREATE TABLE event_cohosts
+(
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    event_id INTEGER NOT NULL,
+    user_id TEXT NOT NULL,
+    FOREIGN KEY (event_id) REFERENCES events (id)
+);
+
+CREATE UNIQUE INDEX event_cohosts_event_id_user_id ON event_cohosts (event_id, user_id);
+
+ALTER TABLE guild_settings ADD COLUMN event_manager_roles TEXT NOT NULL DEFAULT '';
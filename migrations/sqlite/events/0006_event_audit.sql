@@ -0,0 +1,15 @@
+CREATE TABLE event_audit
+(
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    event_id INTEGER NOT NULL,
+    occurrence INTEGER NOT NULL DEFAULT 0,
+    user_id TEXT NOT NULL,
+    action TEXT NOT NULL,
+    field TEXT NOT NULL DEFAULT '',
+    old_value TEXT NOT NULL DEFAULT '',
+    new_value TEXT NOT NULL DEFAULT '',
+    changed_at INTEGER NOT NULL,
+    FOREIGN KEY (event_id) REFERENCES events (id)
+);
+
+CREATE INDEX event_audit_event_id ON event_audit (event_id);
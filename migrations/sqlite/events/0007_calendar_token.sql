@@ -0,0 +1 @@
+ALTER TABLE guild_settings ADD COLUMN calendar_token TEXT NOT NULL DEFAULT '';
@@ -3,4 +3,4 @@ CREATE TABLE messages
   id INTEGER PRIMARY KEY AUTOINCREMENT,
   author_id TEXT NOT NULL,
   message TEXT NOT NULL
-);
\ No newline at end of file
+);
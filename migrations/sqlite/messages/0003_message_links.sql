@@ -0,0 +1,10 @@
+CREATE TABLE message_links
+(
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  message_id INTEGER NOT NULL,
+  guild_id TEXT NOT NULL,
+  url TEXT NOT NULL,
+  FOREIGN KEY (message_id) REFERENCES messages (id)
+);
+
+CREATE INDEX message_links_guild_id_url ON message_links (guild_id, url);
@@ -0,0 +1,13 @@
+ALTER TABLE messages ADD COLUMN channel_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE messages ADD COLUMN discord_message_id TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE message_images
+(
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  message_id INTEGER NOT NULL,
+  guild_id TEXT NOT NULL,
+  hash INTEGER NOT NULL,
+  FOREIGN KEY (message_id) REFERENCES messages (id)
+);
+
+CREATE INDEX message_images_guild_id ON message_images (guild_id);
@@ -0,0 +1,14 @@
+CREATE TABLE penalties
+(
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  guild_id TEXT NOT NULL,
+  user_id TEXT NOT NULL,
+  reason TEXT NOT NULL,
+  channel_id TEXT NOT NULL,
+  discord_message_id TEXT NOT NULL,
+  started_at INTEGER NOT NULL,
+  expires_at INTEGER NOT NULL,
+  lifted_at INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX penalties_guild_id_user_id ON penalties (guild_id, user_id, expires_at);
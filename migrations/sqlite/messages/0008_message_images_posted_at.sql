@@ -0,0 +1,7 @@
+ALTER TABLE message_images ADD COLUMN posted_at INTEGER NOT NULL DEFAULT 0;
+
+UPDATE message_images SET posted_at =
+  COALESCE((SELECT posted_at FROM messages WHERE messages.id = message_images.message_id), 0);
+
+DROP INDEX message_images_guild_id;
+CREATE INDEX message_images_guild_id ON message_images (guild_id, posted_at);
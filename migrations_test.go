@@ -0,0 +1,168 @@
+package main
+
+import (
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	cases := []struct {
+		dir        string
+		wantFirst  int
+		wantLatest int
+	}{
+		{"sqlite/events", 1, 7},
+		{"postgres/events", 2, 7},
+		{"sqlite/messages", 1, 8},
+		{"postgres/messages", 2, 8},
+	}
+
+	for _, c := range cases {
+		migrations, err := loadMigrations(c.dir)
+		if err != nil {
+			t.Fatalf("%s: %v", c.dir, err)
+		}
+		first, latest := migrations[0], migrations[len(migrations)-1]
+		if first.version != c.wantFirst || latest.version != c.wantLatest {
+			t.Fatalf("%s: got versions %d to %d, want %d to %d", c.dir, first.version, latest.version, c.wantFirst,
+				c.wantLatest)
+		}
+		for _, migration := range migrations {
+			if migration.sql == "" && migration.up == nil {
+				t.Fatalf("%s: version %d does nothing", c.dir, migration.version)
+			}
+		}
+	}
+
+	if _, err := loadMigrations("sqlite/nothing"); err == nil {
+		t.Fatal("loaded migrations from a directory that doesn't exist")
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	cases := []struct {
+		dbName      string
+		wantVersion int
+	}{
+		{"events", 7},
+		{"messages", 8},
+	}
+
+	for _, c := range cases {
+		source := filepath.Join(t.TempDir(), c.dbName+".sqlite")
+		version := func(store *sqlDB) (int, int) {
+			var latest, applied int
+			err := store.db.QueryRow(`SELECT MAX(version), COUNT(*) FROM schema_migrations`).Scan(&latest, &applied)
+			if err != nil {
+				t.Fatalf("%s: %v", c.dbName, err)
+			}
+			return latest, applied
+		}
+
+		store, err := OpenDB("sqlite3", source, c.dbName)
+		if err != nil {
+			t.Fatalf("%s: %v", c.dbName, err)
+		}
+		latest, applied := version(store)
+		if latest != c.wantVersion {
+			t.Fatalf("%s: got version %d, want %d", c.dbName, latest, c.wantVersion)
+		}
+		store.db.Close()
+
+		// Opening an up to date database again doesn't apply anything
+		store, err = OpenDB("sqlite3", source, c.dbName)
+		if err != nil {
+			t.Fatalf("%s: reopening: %v", c.dbName, err)
+		}
+		if reopenedLatest, reopenedApplied := version(store); reopenedLatest != latest || reopenedApplied != applied {
+			t.Fatalf("%s: got version %d with %d migrations after reopening, want %d with %d", c.dbName,
+				reopenedLatest, reopenedApplied, latest, applied)
+		}
+
+		// A database from a newer build is left alone
+		_, err = store.db.Exec(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, 'future', 0)`,
+			c.wantVersion+1)
+		if err != nil {
+			t.Fatalf("%s: %v", c.dbName, err)
+		}
+		store.db.Close()
+		if _, err = OpenDB("sqlite3", source, c.dbName); err == nil {
+			t.Fatalf("%s: opened a database at a newer version", c.dbName)
+		}
+	}
+}
+
+func TestMigrateOriginalSchema(t *testing.T) {
+	dir := t.TempDir()
+	// Create a database the way the old scripts did, without recording a schema version
+	createOriginal := func(dbName string, inserts string) string {
+		source := filepath.Join(dir, dbName+".sqlite")
+		db, err := sql.Open("sqlite3", source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		schema, err := migrationFiles.ReadFile("migrations/sqlite/" + dbName + "/0001_initial.sql")
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = db.Exec(string(schema) + inserts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return source
+	}
+
+	eventsSource := createOriginal("events", `INSERT INTO events (name, description, location, event_date,
+        event_time, creator, creator_id) VALUES ('Picnic', 'Bring food', 'Park', '2030-05-01', '7pm', 'creator', '1'),
+        ('Hike', 'Bring water', 'Hills', 'someday', 'soon', 'creator', '1');`)
+	messagesSource := createOriginal("messages", `INSERT INTO messages (author_id, message)
+        VALUES ('1', 'Look at https://www.example.com/page?utm_source=feed');`)
+
+	events, err := OpenDB("sqlite3", eventsSource, "events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer events.db.Close()
+	messages, err := OpenDB("sqlite3", messagesSource, "messages")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer messages.db.Close()
+	eventStore = &SQLEventStore{events}
+	messageStore = &SQLMessageStore{messages}
+
+	cases := []struct {
+		id              string
+		wantStartsAt    time.Time
+		wantDescription string
+	}{
+		{"1", time.Date(2030, time.May, 1, 19, 0, 0, 0, LoadTimezone("")), "Bring food"},
+		// Dates that couldn't be understood are kept in the description
+		{"2", time.Unix(0, 0), "Bring water\n*Originally planned for:* someday soon"},
+	}
+	for _, c := range cases {
+		event, err := eventStore.RetrieveEventByID(c.id)
+		if err != nil || event == nil {
+			t.Fatalf("event %s: got %v, %v", c.id, event, err)
+		}
+		if !event.startsAt.Equal(c.wantStartsAt) || event.description != c.wantDescription {
+			t.Fatalf("event %s: got %v, %q", c.id, event.startsAt, event.description)
+		}
+	}
+
+	// Links in old messages are recorded so they are caught when they are posted again, once the messages are
+	// assigned to a guild
+	_, err = messageStore.AssignUnscopedMessages("guild")
+	if err != nil {
+		t.Fatal(err)
+	}
+	urls := CanonicalURLs("https://example.com/page")
+	original, err := messageStore.DetectRepost("guild", urls, time.Time{})
+	if err != nil || original == nil || !strings.Contains(original.content, "example.com") {
+		t.Fatalf("got %v, %v", original, err)
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// An EventException changes or cancels one occurrence of a recurring Event without touching the rest of the series
+// Occurrences are identified by the time they would have started according to the series' Recurrence
+type EventException struct {
+	eventID     int64
+	occurrence  int64
+	cancelled   bool
+	startsAt    time.Time // zero if the occurrence hasn't been moved
+	location    string    // empty if unchanged
+	description string    // empty if unchanged
+}
+
+// Get all the exceptions to a recurring Event's series, keyed by occurrence
+func (store *SQLEventStore) RetrieveEventExceptions(eventID int64) (map[int64]*EventException, error) {
+	stmt, err := store.prepare(
+		`SELECT event_id, occurrence, cancelled, starts_at, location, description FROM event_exceptions
+        WHERE event_id=?`)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := stmt.Query(eventID)
+	if err != nil {
+		return nil, err
+	}
+
+	exceptions := make(map[int64]*EventException)
+
+	defer result.Close()
+	for result.Next() {
+		var exception EventException
+		var startsAt sql.NullInt64
+		var location, description sql.NullString
+		err := result.Scan(&exception.eventID, &exception.occurrence, &exception.cancelled, &startsAt, &location,
+			&description)
+		if err != nil {
+			return nil, err
+		}
+		if startsAt.Valid {
+			exception.startsAt = time.Unix(startsAt.Int64, 0).UTC()
+		}
+		exception.location = location.String
+		exception.description = description.String
+		exceptions[exception.occurrence] = &exception
+	}
+	err = result.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return exceptions, nil
+}
+
+// Change several columns of a single occurrence of a recurring Event in one transaction, recording each change in
+// the Event's history
+func (store *SQLEventStore) UpdateOccurrenceColumns(eventID int64, occurrence int64, changes []ColumnChange,
+	editorID string) error {
+	tx, err := store.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	for _, change := range changes {
+		if editorID != "" {
+			var oldValue string
+			oldValue, err = store.occurrenceValue(tx, eventID, occurrence, change.column)
+			if err == nil {
+				err = store.audit(tx, occurrenceAuditEntry(eventID, occurrence, editorID, change.column, oldValue,
+					change.value))
+			}
+		}
+		if err == nil {
+			_, err = tx.Exec(store.rebind(
+				`INSERT INTO event_exceptions (event_id, occurrence, `+change.column+`) VALUES (?, ?, ?)
+                ON CONFLICT (event_id, occurrence) DO UPDATE SET `+change.column+`=excluded.`+change.column),
+				eventID, occurrence, change.value)
+		}
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// What a column of one occurrence of a recurring Event was before a change, from its exception if it has one and
+// otherwise from the series
+func (store *SQLEventStore) occurrenceValue(tx *sql.Tx, eventID int64, occurrence int64,
+	columnName string) (string, error) {
+	var value sql.NullString
+	err := tx.QueryRow(store.rebind(`SELECT `+columnName+` FROM event_exceptions WHERE event_id=? AND occurrence=?`),
+		eventID, occurrence).Scan(&value)
+	if err != nil && err != sql.ErrNoRows {
+		return "", err
+	}
+	if value.Valid && value.String != "" {
+		return value.String, nil
+	}
+
+	switch columnName {
+	case "starts_at":
+		return strconv.FormatInt(occurrence, 10), nil
+	case "cancelled":
+		return "0", nil
+	}
+	err = tx.QueryRow(store.rebind(`SELECT `+columnName+` FROM events WHERE id=?`), eventID).Scan(&value)
+	return value.String, err
+}
+
+// The history entry for a change to one occurrence of a recurring Event.  Cancelling an occurrence is recorded as
+// a cancellation rather than an edit.
+func occurrenceAuditEntry(eventID int64, occurrence int64, editorID string, columnName string, oldValue string,
+	newValue interface{}) *AuditEntry {
+	entry := AuditEntry{eventID: eventID, occurrence: occurrence, userID: editorID, action: AuditEdit,
+		field: columnName, oldValue: oldValue, newValue: auditValue(newValue)}
+	if columnName == "cancelled" {
+		entry.action = AuditCancel
+		entry.field = ""
+		entry.oldValue = ""
+		entry.newValue = ""
+	}
+	return &entry
+}
+
+// Cancel a single occurrence of a recurring Event
+func CancelOccurrence(eventID int64, occurrence int64, userID string) error {
+	return eventStore.UpdateOccurrenceColumns(eventID, occurrence, []ColumnChange{{"cancelled", 1}}, userID)
+}
+
+// List the occurrences of an Event whose original start times are in [from, to), up to limit of them.
+// A zero to means no upper bound and a limit of 0 means no limit.  Cancelled occurrences are left out and changed
+// ones have their exceptions applied.  An Event that doesn't repeat is its own only occurrence.
+func ExpandEvent(event *Event, from, to time.Time, limit int) ([]*Event, error) {
+	if event.recurrence == nil {
+		if event.startsAt.Before(from) || (!to.IsZero() && !event.startsAt.Before(to)) {
+			return nil, nil
+		}
+		return []*Event{event}, nil
+	}
+
+	exceptions, err := eventStore.RetrieveEventExceptions(event.id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Ask for extra occurrences to make up for any that turn out to be cancelled
+	expandLimit := limit
+	if limit > 0 {
+		expandLimit += len(exceptions)
+	}
+
+	var occurrences []*Event
+	for _, startsAt := range event.recurrence.Occurrences(event.startsAt, LoadTimezone(event.timezone), from, to,
+		expandLimit) {
+		occurrence := *event
+		occurrence.series = event
+		occurrence.occurrence = startsAt.Unix()
+		occurrence.startsAt = startsAt
+
+		if exception, ok := exceptions[occurrence.occurrence]; ok {
+			if exception.cancelled {
+				continue
+			}
+			if !exception.startsAt.IsZero() {
+				occurrence.startsAt = exception.startsAt
+			}
+			if exception.location != "" {
+				occurrence.location = exception.location
+			}
+			if exception.description != "" {
+				occurrence.description = exception.description
+			}
+		}
+
+		occurrences = append(occurrences, &occurrence)
+		if limit > 0 && len(occurrences) == limit {
+			break
+		}
+	}
+
+	return occurrences, nil
+}
+
+// Find the occurrence of a recurring Event that falls on the date typed by a user
+func FindOccurrence(event *Event, date string, now time.Time) (*Event, error) {
+	if event.recurrence == nil {
+		return nil, errors.New("**" + event.name + "** doesn't repeat.  Leave out the @date to use it.")
+	}
+
+	day, err := ParseEventDate(date, LoadTimezone(event.timezone), now)
+	if err != nil {
+		return nil, err
+	}
+
+	occurrences, err := ExpandEvent(event, day, day.AddDate(0, 0, 1), 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(occurrences) == 0 {
+		return nil, errors.New("**" + event.name + "** doesn't happen on " + day.Format("January 2, 2006") + ".")
+	}
+	return occurrences[0], nil
+}
+
+// Find the occurrence of a recurring Event identified by its original start time
+func RetrieveOccurrence(event *Event, occurrence int64) (*Event, error) {
+	if event.recurrence == nil {
+		return event, nil
+	}
+
+	occurrences, err := ExpandEvent(event, time.Unix(occurrence, 0), time.Unix(occurrence+1, 0), 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(occurrences) == 0 {
+		return nil, errors.New("That date of **" + event.name + "** was cancelled.")
+	}
+	return occurrences[0], nil
+}
+
+// Pick the occurrence of a recurring Event on the date typed by a user, or its next upcoming occurrence if no date
+// was given.  Events that don't repeat are returned as they are.
+func selectOccurrence(event *Event, date string, now time.Time) (*Event, error) {
+	if date != "" {
+		return FindOccurrence(event, date, now)
+	}
+	return NextOccurrence(event, now)
+}
+
+// Split an event search like "12@oct 21" into the search and the date of one occurrence of a recurring Event
+func splitOccurrenceSearch(search string) (string, string) {
+	if i := strings.LastIndex(search, "@"); i >= 0 {
+		return strings.TrimSpace(search[:i]), strings.TrimSpace(search[i+1:])
+	}
+	return search, ""
+}
+
+// Find the next occurrence of a recurring Event that hasn't started yet
+// An Event that doesn't repeat is returned as it is
+func NextOccurrence(event *Event, now time.Time) (*Event, error) {
+	if event.recurrence == nil {
+		return event, nil
+	}
+
+	occurrences, err := ExpandEvent(event, now, time.Time{}, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(occurrences) == 0 {
+		return nil, errors.New("**" + event.name + "** has no more upcoming dates.")
+	}
+	return occurrences[0], nil
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Check whether a user is the bot's owner, who can manage everything on every server
+func isBotOwner(userID string) bool {
+	return OWNER_ID != "" && userID == OWNER_ID
+}
+
+// Check whether the user who ran a command can change the server's settings.  Administrators always can.
+func canManageServer(ctx *CommandContext) bool {
+	if isBotOwner(ctx.user.ID) {
+		return true
+	}
+	perms, err := ctx.session.UserChannelPermissions(ctx.user.ID, ctx.channelID)
+	return err == nil && perms&discordgo.PermissionManageServer != 0
+}
+
+// Check whether the user who ran a command can manage every Event on the server: members of the server's event
+// manager roles, anyone who can manage the server, and the bot's owner
+func canManageAllEvents(ctx *CommandContext) bool {
+	if canManageServer(ctx) {
+		return true
+	}
+	if ctx.member == nil {
+		return false
+	}
+
+	managerRoles, err := RetrieveGuildManagerRoles(ctx.guildID)
+	if err != nil {
+		fmt.Println("Error retrieving event manager roles: " + err.Error())
+	}
+	for _, role := range ctx.member.Roles {
+		for _, managerRole := range managerRoles {
+			if role == managerRole {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Check whether the user who ran a command can edit, cancel or otherwise manage an Event: its creator, its
+// co-hosts, and anyone who can manage every Event on the server
+func CanManageEvent(ctx *CommandContext, event *Event) bool {
+	if ctx.user.ID == event.creatorID || canManageAllEvents(ctx) {
+		return true
+	}
+
+	cohosts, err := eventStore.RetrieveCohosts(event.id)
+	if err != nil {
+		fmt.Println("Error retrieving co-hosts: " + err.Error())
+	}
+	for _, cohost := range cohosts {
+		if cohost == ctx.user.ID {
+			return true
+		}
+	}
+	return false
+}
+
+// Find the one Event a search matches, or tell the user why there isn't one and return nil
+func findOneEvent(ctx *CommandContext, eventSearch string, retry string) *Event {
+	events, err := RetrieveEvent(ctx.guildID, eventSearch)
+	if err != nil {
+		ctx.reply(err.Error())
+		return nil
+	}
+	if len(events) > 1 {
+		replyMatches(ctx, events, retry)
+		return nil
+	} else if len(events) == 0 {
+		ctx.reply("No events found.  Try a different search.")
+		return nil
+	}
+	return events[0]
+}
+
+// Read a user mention or a bare user ID
+func parseUserMention(mention string) string {
+	return strings.TrimPrefix(strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(mention), "<@"), ">"), "!")
+}
+
+// Let someone manage an Event as if they had created it, or stop them
+func cohostCommand(ctx *CommandContext, action, eventSearch, userID string) {
+	action = strings.ToLower(strings.TrimSpace(action))
+	userID = parseUserMention(userID)
+	if (action != "add" && action != "remove") || userID == "" {
+		ctx.reply("Usage: !event cohost add|remove eventID|@user")
+		return
+	}
+
+	event := findOneEvent(ctx, eventSearch, "Select one by its ID with !event cohost "+action+" <ID>|@user.")
+	if event == nil {
+		return
+	}
+	if !CanManageEvent(ctx, event) {
+		ctx.reply("You can't change the co-hosts of an event you don't manage.")
+		return
+	}
+
+	if action == "remove" {
+		err := eventStore.RemoveCohost(event.id, userID, ctx.user.ID)
+		if err != nil {
+			ctx.reply(err.Error())
+			return
+		}
+		ctx.reply("<@" + userID + "> no longer co-hosts **" + event.name + "**.")
+		return
+	}
+
+	if userID == event.creatorID {
+		ctx.reply("<@" + userID + "> created **" + event.name + "**, so they can already manage it.")
+		return
+	}
+	if _, err := ctx.session.GuildMember(ctx.guildID, userID); err != nil {
+		ctx.reply("I couldn't find that user on this server.")
+		return
+	}
+	err := eventStore.AddCohost(event.id, userID, ctx.user.ID)
+	if err != nil {
+		ctx.reply(err.Error())
+		return
+	}
+	ctx.reply("<@" + userID + "> can now edit and cancel **" + event.name + "**.")
+}
+
+// Make someone else an Event's creator.  Only its creator and people who can manage every Event can give it away,
+// so that an Event whose creator left the server can still be looked after.
+func transferCommand(ctx *CommandContext, eventSearch, userID string) {
+	userID = parseUserMention(userID)
+	if userID == "" {
+		ctx.reply("Usage: !event transfer eventID|@user")
+		return
+	}
+
+	event := findOneEvent(ctx, eventSearch, "Select one by its ID with !event transfer <ID>|@user.")
+	if event == nil {
+		return
+	}
+	if ctx.user.ID != event.creatorID && !canManageAllEvents(ctx) {
+		ctx.reply("You can't give away an event you didn't create.")
+		return
+	}
+
+	member, err := ctx.session.GuildMember(ctx.guildID, userID)
+	if err != nil {
+		ctx.reply("I couldn't find that user on this server.")
+		return
+	}
+	err = eventStore.TransferEvent(event.id, member.User.Username, userID, ctx.user.ID)
+	if err != nil {
+		ctx.reply(err.Error())
+		return
+	}
+	ctx.reply("<@" + userID + "> now owns **" + event.name + "**.")
+	RefreshAnnouncement(ctx.session, strconv.FormatInt(event.id, 10))
+}
+
+// Show the roles whose members can manage every event on the server, or add or remove one
+func managersCommand(ctx *CommandContext, action, roleID string) {
+	roles, err := RetrieveGuildManagerRoles(ctx.guildID)
+	if err != nil {
+		ctx.reply(err.Error())
+		return
+	}
+
+	action = strings.ToLower(strings.TrimSpace(action))
+	if action != "" {
+		if !canManageServer(ctx) {
+			ctx.reply("You need the Manage Server permission to change who manages events.")
+			return
+		}
+		roleID = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(roleID), "<@&"), ">")
+		if action != "add" && action != "remove" {
+			ctx.reply("Usage: !event managers [add|remove @role]")
+			return
+		}
+		if _, err := ctx.session.State.Role(ctx.guildID, roleID); err != nil && action == "add" {
+			ctx.reply("I couldn't find that role on this server.")
+			return
+		}
+
+		var updated []string
+		for _, role := range roles {
+			if role != roleID {
+				updated = append(updated, role)
+			}
+		}
+		if action == "add" {
+			updated = append(updated, roleID)
+		}
+		if err := UpdateGuildManagerRoles(ctx.guildID, updated); err != nil {
+			ctx.reply(err.Error())
+			return
+		}
+		roles = updated
+	}
+
+	if len(roles) == 0 {
+		ctx.reply("Only event creators, their co-hosts and people who can manage the server can manage events.")
+		return
+	}
+	ctx.reply("Members of <@&" + strings.Join(roles, ">, <@&") + "> can manage every event on this server.")
+}
+
+// Let a user manage an Event in the DB, recording who made them a co-host in its history
+func (store *SQLEventStore) AddCohost(eventID int64, userID string, addedBy string) error {
+	stmt, err := store.prepare(`INSERT INTO event_cohosts (event_id, user_id) VALUES (?, ?)
+        ON CONFLICT (event_id, user_id) DO NOTHING`)
+	if err != nil {
+		return err
+	}
+
+	tx, err := store.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Stmt(stmt).Exec(eventID, userID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if added, _ := result.RowsAffected(); added > 0 {
+		err = store.audit(tx, &AuditEntry{eventID: eventID, userID: addedBy, action: AuditCohost,
+			newValue: userID})
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Stop a user managing an Event they co-host in the DB, recording who removed them in its history
+func (store *SQLEventStore) RemoveCohost(eventID int64, userID string, removedBy string) error {
+	stmt, err := store.prepare(`DELETE FROM event_cohosts WHERE event_id=? AND user_id=?`)
+	if err != nil {
+		return err
+	}
+
+	tx, err := store.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Stmt(stmt).Exec(eventID, userID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if removed, _ := result.RowsAffected(); removed > 0 {
+		err = store.audit(tx, &AuditEntry{eventID: eventID, userID: removedBy, action: AuditCohost,
+			oldValue: userID})
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Make someone else an Event's creator in the DB, dropping them from its co-hosts and recording the change of owner
+// in its history
+func (store *SQLEventStore) TransferEvent(eventID int64, creator string, creatorID string,
+	transferredBy string) error {
+	stmt, err := store.prepare(`UPDATE events SET creator=?, creator_id=? WHERE id=?`)
+	if err != nil {
+		return err
+	}
+	cohostStmt, err := store.prepare(`DELETE FROM event_cohosts WHERE event_id=? AND user_id=?`)
+	if err != nil {
+		return err
+	}
+
+	tx, err := store.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	var oldCreatorID string
+	err = tx.QueryRow(store.rebind(`SELECT creator_id FROM events WHERE id=?`), eventID).Scan(&oldCreatorID)
+	if err == nil {
+		_, err = tx.Stmt(stmt).Exec(creator, creatorID, eventID)
+	}
+	if err == nil {
+		_, err = tx.Stmt(cohostStmt).Exec(eventID, creatorID)
+	}
+	if err == nil {
+		err = store.audit(tx, &AuditEntry{eventID: eventID, userID: transferredBy, action: AuditEdit,
+			field: "creator_id", oldValue: oldCreatorID, newValue: creatorID})
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Get the IDs of the users who co-host an Event from the DB
+func (store *SQLEventStore) RetrieveCohosts(eventID int64) ([]string, error) {
+	stmt, err := store.prepare(`SELECT user_id FROM event_cohosts WHERE event_id=? ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := stmt.Query(eventID)
+	if err != nil {
+		return nil, err
+	}
+	defer result.Close()
+
+	var cohosts []string
+	for result.Next() {
+		var userID string
+		err = result.Scan(&userID)
+		if err != nil {
+			return nil, err
+		}
+		cohosts = append(cohosts, userID)
+	}
+	return cohosts, result.Err()
+}
+
+// List an Event's co-hosts for !event info, or nothing if it doesn't have any
+func cohostLine(event *Event) string {
+	cohosts, err := eventStore.RetrieveCohosts(event.id)
+	if err != nil || len(cohosts) == 0 {
+		return ""
+	}
+	return "**Co-hosts:** <@" + strings.Join(cohosts, ">, <@") + ">\n"
+}
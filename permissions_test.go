@@ -0,0 +1,107 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestCanManageEvent(t *testing.T) {
+	owner := OWNER_ID
+	OWNER_ID = "botOwner"
+	defer func() { OWNER_ID = owner }()
+
+	roles := map[string][]string{
+		"serverOwner": nil,
+		"admin":       {"admins"},
+		"moderator":   {"moderators"},
+		"planner":     {"planners"},
+		"creator":     nil,
+		"cohost":      nil,
+		"member":      {"players"},
+	}
+	guild := &discordgo.Guild{
+		ID:      "guild",
+		OwnerID: "serverOwner",
+		Roles: []*discordgo.Role{
+			{ID: "guild", Permissions: discordgo.PermissionSendMessages}, // @everyone
+			{ID: "admins", Permissions: discordgo.PermissionAdministrator},
+			{ID: "moderators", Permissions: discordgo.PermissionManageServer},
+			{ID: "planners"},
+			{ID: "players"},
+		},
+		Channels: []*discordgo.Channel{{ID: "channel", GuildID: "guild"}},
+	}
+	for userID, userRoles := range roles {
+		guild.Members = append(guild.Members, &discordgo.Member{GuildID: "guild", User: &discordgo.User{ID: userID},
+			Roles: userRoles})
+	}
+
+	cases := []struct {
+		userID           string
+		wantManageServer bool
+		wantManageAll    bool
+		wantManageEvent  bool
+	}{
+		{"botOwner", true, true, true},
+		{"serverOwner", true, true, true},
+		{"admin", true, true, true},
+		{"moderator", true, true, true},
+		{"planner", false, true, true},
+		{"creator", false, false, true},
+		{"cohost", false, false, true},
+		{"member", false, false, false},
+	}
+
+	forEachStore(t, func(t *testing.T) {
+		s, _ := discordgo.New("Bot token")
+		err := s.State.GuildAdd(guild)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = UpdateGuildManagerRoles("guild", []string{"planners"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		event := createTestEvent(t, "guild", "Picnic", time.Now().Add(time.Hour), 0, "creator")
+		err = eventStore.AddCohost(event.id, "cohost", "creator")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, c := range cases {
+			ctx := &CommandContext{session: s, guildID: "guild", channelID: "channel",
+				user: &discordgo.User{ID: c.userID}}
+			ctx.member, _ = s.State.Member("guild", c.userID)
+
+			if got := canManageServer(ctx); got != c.wantManageServer {
+				t.Fatalf("%s: got canManageServer %v, want %v", c.userID, got, c.wantManageServer)
+			}
+			if got := canManageAllEvents(ctx); got != c.wantManageAll {
+				t.Fatalf("%s: got canManageAllEvents %v, want %v", c.userID, got, c.wantManageAll)
+			}
+			if got := CanManageEvent(ctx, event); got != c.wantManageEvent {
+				t.Fatalf("%s: got CanManageEvent %v, want %v", c.userID, got, c.wantManageEvent)
+			}
+		}
+	})
+}
+
+func TestParseUserMention(t *testing.T) {
+	cases := []struct {
+		mention string
+		want    string
+	}{
+		{"<@1234>", "1234"},
+		{"<@!1234>", "1234"},
+		{" 1234 ", "1234"},
+		{"", ""},
+	}
+
+	for _, c := range cases {
+		if got := parseUserMention(c.mention); got != c.want {
+			t.Fatalf("%q: got %q, want %q", c.mention, got, c.want)
+		}
+	}
+}
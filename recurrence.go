@@ -0,0 +1,456 @@
+package main
+
+import (
+	"errors"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	rruleDays = []string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+	weekOrdinals = map[string]int{
+		"1st": 1, "first": 1, "2nd": 2, "second": 2, "3rd": 3, "third": 3, "4th": 4, "fourth": 4,
+		"5th": 5, "fifth": 5, "last": -1,
+	}
+
+	everyPattern = regexp.MustCompile(`^every\s+(?:(\d+)\s+)?(day|days|week|weeks|month|months)$`)
+	countPattern = regexp.MustCompile(`\s+(?:for\s+(\d+)(?:\s+(?:times|occurrences|weeks|days|months))?|(\d+)\s+times|x\s*(\d+))$`)
+	byDayPattern = regexp.MustCompile(`^([+-]?\d)?(SU|MO|TU|WE|TH|FR|SA)$`)
+)
+
+const (
+	// Upper bound on how many occurrences of a recurring Event are ever expanded at once, and on how many periods in
+	// a row can go by without one before a series is assumed to have none left
+	maxOccurrences = 1000
+
+	// Most times a series can be set to repeat.  The occurrences before a date have to be counted to know whether
+	// the series has ended by then, so this bounds how far back that has to go.
+	maxRecurrenceCount = 1000
+
+	recurrenceHelp = "Try something like daily, weekly on mon,thu, every 2 weeks, monthly on 2nd tue, " +
+		"optionally followed by until 2026-12-31 or for 10 times."
+)
+
+// A Recurrence describes how an Event repeats.  It covers the subset of iCalendar RRULEs that the planner supports.
+type Recurrence struct {
+	frequency string         // DAILY, WEEKLY or MONTHLY
+	interval  int            // repeat every interval days, weeks or months
+	weekdays  []time.Weekday // WEEKLY: the days of the week it happens on, defaulting to the first occurrence's
+	week      int            // MONTHLY: which week of the month (1-5, or -1 for the last), 0 for the same day each month
+	weekday   time.Weekday   // MONTHLY: the day of the week in that week
+	until     time.Time      // zero if the series has no end date
+	count     int            // 0 if there is no limit on the number of occurrences
+}
+
+// Parse a recurrence rule typed by a user such as "weekly on mon,thu until dec 31" or "monthly on 2nd tue for 6".
+// Raw RRULEs like "FREQ=WEEKLY;BYDAY=MO" are accepted too.  Returns nil if the input says the Event doesn't repeat.
+func ParseRecurrence(input string, loc *time.Location, now time.Time) (*Recurrence, error) {
+	input = strings.TrimSpace(input)
+	if strings.HasPrefix(strings.ToUpper(input), "FREQ=") {
+		return ParseRRule(input, loc)
+	}
+
+	input = normalizeTimeInput(input)
+	switch input {
+	case "", "none", "never", "once":
+		return nil, nil
+	}
+
+	rule := Recurrence{interval: 1}
+
+	if i := strings.Index(input, " until "); i >= 0 {
+		day, err := ParseEventDate(input[i+len(" until "):], loc, now)
+		if err != nil {
+			return nil, err
+		}
+		rule.until = day.AddDate(0, 0, 1).Add(-time.Second).UTC() // the end of that day
+		input = input[:i]
+	}
+	if match := countPattern.FindStringSubmatch(input); match != nil {
+		rule.count, _ = strconv.Atoi(match[1] + match[2] + match[3])
+		if rule.count < 1 {
+			return nil, errors.New("A repeating event needs to happen at least once.")
+		}
+		if rule.count > maxRecurrenceCount {
+			return nil, errors.New("A repeating event can happen at most " + strconv.Itoa(maxRecurrenceCount) +
+				" times.  Leave out the count for one that keeps going.")
+		}
+		input = strings.TrimSpace(input[:len(input)-len(match[0])])
+	}
+
+	frequency, on := input, ""
+	if i := strings.Index(input, " on "); i >= 0 {
+		frequency, on = input[:i], strings.TrimPrefix(input[i+len(" on "):], "the ")
+	}
+
+	switch frequency {
+	case "daily":
+		rule.frequency = "DAILY"
+	case "weekly":
+		rule.frequency = "WEEKLY"
+	case "biweekly", "fortnightly":
+		rule.frequency, rule.interval = "WEEKLY", 2
+	case "monthly":
+		rule.frequency = "MONTHLY"
+	default:
+		match := everyPattern.FindStringSubmatch(frequency)
+		if match == nil {
+			// "every mon and thu" is short for "weekly on mon and thu"
+			if days, err := parseWeekdayList(strings.TrimPrefix(frequency, "every ")); err == nil && on == "" {
+				rule.frequency, rule.weekdays = "WEEKLY", days
+				break
+			}
+			return nil, errors.New("I couldn't understand how \"" + input + "\" repeats.  " + recurrenceHelp)
+		}
+		if match[1] != "" {
+			rule.interval, _ = strconv.Atoi(match[1])
+		}
+		switch strings.TrimSuffix(match[2], "s") {
+		case "day":
+			rule.frequency = "DAILY"
+		case "week":
+			rule.frequency = "WEEKLY"
+		case "month":
+			rule.frequency = "MONTHLY"
+		}
+	}
+	if rule.interval < 1 {
+		return nil, errors.New("A repeating event needs an interval of at least 1.")
+	}
+
+	if on != "" {
+		switch rule.frequency {
+		case "WEEKLY":
+			days, err := parseWeekdayList(on)
+			if err != nil {
+				return nil, err
+			}
+			rule.weekdays = days
+		case "MONTHLY":
+			fields := strings.Fields(on)
+			if len(fields) != 2 {
+				return nil, errors.New("Monthly events repeat on a weekday of the month, like 2nd tue or last fri.")
+			}
+			week, okWeek := weekOrdinals[fields[0]]
+			weekday, okDay := weekdays[fields[1]]
+			if !okWeek || !okDay {
+				return nil, errors.New("Monthly events repeat on a weekday of the month, like 2nd tue or last fri.")
+			}
+			rule.week, rule.weekday = week, weekday
+		default:
+			return nil, errors.New("Daily events can't be limited to certain days.  Use weekly on mon,tue instead.")
+		}
+	}
+
+	return &rule, nil
+}
+
+// Parse a list of weekdays such as "mon,thu" or "tuesday and friday"
+func parseWeekdayList(input string) ([]time.Weekday, error) {
+	input = strings.Replace(strings.Replace(input, " and ", ",", -1), "&", ",", -1)
+	var days []time.Weekday
+	for _, name := range strings.Split(input, ",") {
+		day, ok := weekdays[strings.TrimSpace(name)]
+		if !ok {
+			return nil, errors.New("\"" + strings.TrimSpace(name) + "\" is not a day of the week.")
+		}
+		days = append(days, day)
+	}
+	sortWeekdays(days)
+	return days, nil
+}
+
+// Parse the supported subset of an iCalendar RRULE, e.g. "FREQ=MONTHLY;BYDAY=-1FR;COUNT=6"
+// Floating UNTIL values are interpreted in loc.
+func ParseRRule(input string, loc *time.Location) (*Recurrence, error) {
+	rule := Recurrence{interval: 1}
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(strings.ToUpper(strings.TrimPrefix(strings.TrimSpace(input), "RRULE:")), ";") {
+		keyValue := strings.SplitN(part, "=", 2)
+		if len(keyValue) != 2 {
+			return nil, errors.New("Malformed recurrence rule part \"" + part + "\".")
+		}
+		key, value := keyValue[0], keyValue[1]
+		if seen[key] {
+			return nil, errors.New("Recurrence rule part " + key + " is given more than once.")
+		}
+		seen[key] = true
+
+		var err error
+		switch key {
+		case "FREQ":
+			if value != "DAILY" && value != "WEEKLY" && value != "MONTHLY" {
+				return nil, errors.New("Only daily, weekly and monthly events are supported, not " +
+					strings.ToLower(value) + ".")
+			}
+			rule.frequency = value
+		case "INTERVAL":
+			rule.interval, err = strconv.Atoi(value)
+		case "COUNT":
+			rule.count, err = strconv.Atoi(value)
+		case "UNTIL":
+			rule.until, err = parseICalTime(value, loc)
+			if len(value) == 8 {
+				// A plain date includes the whole day
+				rule.until = rule.until.AddDate(0, 0, 1).Add(-time.Second)
+			}
+		case "WKST":
+			// Weeks always start on Monday, which is the iCalendar default
+		case "BYDAY":
+			for _, day := range strings.Split(value, ",") {
+				match := byDayPattern.FindStringSubmatch(day)
+				if match == nil {
+					return nil, errors.New("Unsupported BYDAY value \"" + day + "\".")
+				}
+				weekday := time.Weekday(indexOf(rruleDays, match[2]))
+				if match[1] != "" {
+					// Only one weekday of the month is supported, like 2nd tue, not 1st and 3rd mon
+					if rule.week != 0 {
+						return nil, errors.New("Monthly events can only repeat on one weekday of the month, not " +
+							value + ".")
+					}
+					rule.week, _ = strconv.Atoi(match[1])
+					rule.weekday = weekday
+					if rule.week == 0 {
+						return nil, errors.New("Unsupported BYDAY value \"" + day + "\".")
+					}
+				} else {
+					for _, existing := range rule.weekdays {
+						if existing == weekday {
+							return nil, errors.New("BYDAY lists " + match[2] + " more than once.")
+						}
+					}
+					rule.weekdays = append(rule.weekdays, weekday)
+				}
+			}
+		default:
+			return nil, errors.New("Recurrence rule part " + key + " is not supported.")
+		}
+		if err != nil {
+			return nil, errors.New("Invalid recurrence rule value \"" + part + "\".")
+		}
+	}
+
+	if rule.frequency == "" {
+		return nil, errors.New("A recurrence rule needs a FREQ.")
+	}
+	if rule.interval < 1 || rule.count < 0 || (rule.week != 0 && rule.frequency != "MONTHLY") ||
+		(len(rule.weekdays) > 0 && rule.frequency != "WEEKLY") || rule.week < -1 || rule.week > 5 {
+		return nil, errors.New("Recurrence rule \"" + input + "\" is not supported.")
+	}
+	if rule.count > maxRecurrenceCount {
+		return nil, errors.New("Repeating events can happen at most " + strconv.Itoa(maxRecurrenceCount) +
+			" times, not " + strconv.Itoa(rule.count) + ".")
+	}
+	sortWeekdays(rule.weekdays)
+
+	return &rule, nil
+}
+
+// Parse an iCalendar DATE or DATE-TIME value such as 20261231, 20261231T190000 or 20261231T190000Z
+// Values without a trailing Z are floating and are interpreted in loc
+func parseICalTime(value string, loc *time.Location) (time.Time, error) {
+	switch {
+	case strings.HasSuffix(value, "Z"):
+		return time.Parse("20060102T150405Z", value)
+	case len(value) == 8:
+		return time.ParseInLocation("20060102", value, loc)
+	default:
+		return time.ParseInLocation("20060102T150405", value, loc)
+	}
+}
+
+// Format the Recurrence as an iCalendar RRULE value, which is also how it is stored in the DB
+func (rule *Recurrence) String() string {
+	parts := []string{"FREQ=" + rule.frequency}
+	if rule.interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(rule.interval))
+	}
+	if len(rule.weekdays) > 0 {
+		var days []string
+		for _, day := range rule.weekdays {
+			days = append(days, rruleDays[day])
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if rule.week != 0 {
+		parts = append(parts, "BYDAY="+strconv.Itoa(rule.week)+rruleDays[rule.weekday])
+	}
+	if !rule.until.IsZero() {
+		parts = append(parts, "UNTIL="+rule.until.UTC().Format("20060102T150405Z"))
+	}
+	if rule.count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(rule.count))
+	}
+	return strings.Join(parts, ";")
+}
+
+// Describe the Recurrence in plain English, e.g. "every 2 weeks on Monday and Thursday, 10 times"
+func (rule *Recurrence) Describe(loc *time.Location) string {
+	units := map[string]string{"DAILY": "day", "WEEKLY": "week", "MONTHLY": "month"}
+	description := "every " + units[rule.frequency]
+	if rule.interval > 1 {
+		description = "every " + strconv.Itoa(rule.interval) + " " + units[rule.frequency] + "s"
+	}
+
+	if len(rule.weekdays) > 0 {
+		var days []string
+		for _, day := range rule.weekdays {
+			days = append(days, day.String())
+		}
+		description += " on " + strings.Join(days, ", ")
+	}
+	if rule.week != 0 {
+		ordinals := map[int]string{1: "1st", 2: "2nd", 3: "3rd", 4: "4th", 5: "5th", -1: "last"}
+		description += " on the " + ordinals[rule.week] + " " + rule.weekday.String()
+	}
+
+	if !rule.until.IsZero() {
+		description += " until " + rule.until.In(loc).Format("January 2, 2006")
+	}
+	if rule.count > 0 {
+		description += ", " + pluralize(int64(rule.count), "time")
+	}
+	return description
+}
+
+// List the start times of the occurrences of a series whose first occurrence is at start, in order.
+// Only occurrences in [from, to) are returned, where a zero to means no upper bound, and at most limit of them
+// unless limit is 0.  Occurrences keep the same wall clock time in loc across daylight saving changes.
+func (rule *Recurrence) Occurrences(start time.Time, loc *time.Location, from, to time.Time, limit int) []time.Time {
+	if limit <= 0 || limit > maxOccurrences {
+		limit = maxOccurrences
+	}
+
+	local := start.In(loc)
+	at := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, local.Hour(), local.Minute(), local.Second(), 0, loc)
+	}
+
+	var occurrences []time.Time
+	generated := 0
+	idle := 0
+	// Returns false once the series has ended or enough occurrences have been found
+	emit := func(t time.Time) bool {
+		idle = 0
+		if t.Before(start) {
+			return true
+		}
+		if (!rule.until.IsZero() && t.After(rule.until)) || (rule.count > 0 && generated >= rule.count) ||
+			(!to.IsZero() && !t.Before(to)) {
+			return false
+		}
+		generated++
+		if !t.Before(from) {
+			occurrences = append(occurrences, t.UTC())
+		}
+		return len(occurrences) < limit
+	}
+
+	// Skip straight to the periods around from, unless the occurrences before it have to be counted.  Starting a
+	// period early covers weeks that begin before the day from is on.
+	first := 0
+	if rule.count == 0 && from.After(start) {
+		first = rule.periodsBetween(local, from.In(loc))
+		first -= first%rule.interval + rule.interval
+		if first < 0 {
+			first = 0
+		}
+	}
+
+	for period := first; idle < maxOccurrences; period += rule.interval {
+		idle++
+		switch rule.frequency {
+		case "DAILY":
+			if !emit(at(local.Year(), local.Month(), local.Day()+period)) {
+				return occurrences
+			}
+
+		case "WEEKLY":
+			days := rule.weekdays
+			if len(days) == 0 {
+				days = []time.Weekday{local.Weekday()}
+			}
+			// Weeks start on Monday
+			monday := local.Day() - (int(local.Weekday())+6)%7 + period*7
+			for _, day := range days {
+				if !emit(at(local.Year(), local.Month(), monday+(int(day)+6)%7)) {
+					return occurrences
+				}
+			}
+
+		case "MONTHLY":
+			first := time.Date(local.Year(), local.Month()+time.Month(period), 1, 0, 0, 0, 0, loc)
+			day := local.Day()
+			if rule.week != 0 {
+				day = nthWeekday(first.Year(), first.Month(), rule.week, rule.weekday, loc)
+			}
+			// Skip months that don't have this day, like the 31st or a 5th Friday
+			if day > 0 && day <= daysIn(first.Year(), first.Month(), loc) {
+				if !emit(at(first.Year(), first.Month(), day)) {
+					return occurrences
+				}
+			}
+
+		default:
+			return occurrences
+		}
+	}
+
+	return occurrences
+}
+
+// Count the days, weeks or months from the one start is in to the one end is in, by the calendar
+func (rule *Recurrence) periodsBetween(start, end time.Time) int {
+	startDay := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
+	endDay := time.Date(end.Year(), end.Month(), end.Day(), 0, 0, 0, 0, time.UTC)
+	days := int(endDay.Sub(startDay).Hours() / 24)
+
+	switch rule.frequency {
+	case "WEEKLY":
+		return days / 7
+	case "MONTHLY":
+		return (end.Year()-start.Year())*12 + int(end.Month()) - int(start.Month())
+	}
+	return days
+}
+
+// Find the day of the month of the nth weekday in a month, where n is -1 for the last one
+// Returns 0 if the month doesn't have that many of the weekday
+func nthWeekday(year int, month time.Month, n int, weekday time.Weekday, loc *time.Location) int {
+	if n < 0 {
+		last := daysIn(year, month, loc)
+		lastWeekday := time.Date(year, month, last, 0, 0, 0, 0, loc).Weekday()
+		return last - (int(lastWeekday)-int(weekday)+7)%7
+	}
+	firstWeekday := time.Date(year, month, 1, 0, 0, 0, 0, loc).Weekday()
+	day := 1 + (int(weekday)-int(firstWeekday)+7)%7 + (n-1)*7
+	if day > daysIn(year, month, loc) {
+		return 0
+	}
+	return day
+}
+
+func daysIn(year int, month time.Month, loc *time.Location) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, loc).Day()
+}
+
+// Sort weekdays starting from Monday
+func sortWeekdays(days []time.Weekday) {
+	sort.Slice(days, func(i, j int) bool {
+		return (days[i]+6)%7 < (days[j]+6)%7
+	})
+}
+
+func indexOf(values []string, value string) int {
+	for i, v := range values {
+		if v == value {
+			return i
+		}
+	}
+	return -1
+}
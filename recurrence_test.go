@@ -0,0 +1,159 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRecurrence(t *testing.T) {
+	newYork, _ := time.LoadLocation("America/New_York")
+	now := time.Date(2026, time.October, 18, 12, 0, 0, 0, newYork)
+
+	cases := []struct {
+		input   string
+		want    string // the rule as an RRULE, or empty if the Event doesn't repeat or the input is rejected
+		wantErr bool
+	}{
+		{"daily", "FREQ=DAILY", false},
+		{"Weekly on mon,thu", "FREQ=WEEKLY;BYDAY=MO,TH", false},
+		{"every thursday and monday", "FREQ=WEEKLY;BYDAY=MO,TH", false},
+		{"biweekly", "FREQ=WEEKLY;INTERVAL=2", false},
+		{"every 3 days", "FREQ=DAILY;INTERVAL=3", false},
+		{"monthly on the last fri", "FREQ=MONTHLY;BYDAY=-1FR", false},
+		{"monthly on 2nd tue for 6", "FREQ=MONTHLY;BYDAY=2TU;COUNT=6", false},
+		{"weekly 10 times", "FREQ=WEEKLY;COUNT=10", false},
+		// The end date is inclusive, so the series runs until midnight at the end of Dec 31 in New York
+		{"weekly until dec 31", "FREQ=WEEKLY;UNTIL=20270101T045959Z", false},
+		{"FREQ=WEEKLY;BYDAY=TH,MO", "FREQ=WEEKLY;BYDAY=MO,TH", false},
+		{"never", "", false},
+		{"", "", false},
+
+		{"hourly", "", true},
+		{"daily on mon", "", true},
+		{"monthly on tue", "", true},
+		{"weekly on funday", "", true},
+		{"every 0 days", "", true},
+		{"weekly for 0 times", "", true},
+		{"weekly for 1001 times", "", true},
+		{"weekly until someday", "", true},
+	}
+
+	for _, c := range cases {
+		rule, err := ParseRecurrence(c.input, newYork, now)
+		if (err != nil) != c.wantErr {
+			t.Fatalf("%q: got error %v, want error %v", c.input, err, c.wantErr)
+		}
+		got := ""
+		if rule != nil {
+			got = rule.String()
+		}
+		if got != c.want {
+			t.Fatalf("%q: got %q, want %q", c.input, got, c.want)
+		}
+	}
+}
+
+func TestParseRRule(t *testing.T) {
+	newYork, _ := time.LoadLocation("America/New_York")
+
+	cases := []struct {
+		input   string
+		want    string // how the rule is stored, or empty if it is rejected
+		wantErr bool
+	}{
+		{"RRULE:FREQ=MONTHLY;BYDAY=-1FR;COUNT=6", "FREQ=MONTHLY;BYDAY=-1FR;COUNT=6", false},
+		{"freq=weekly;interval=2;byday=fr,mo;wkst=mo", "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,FR", false},
+		{"FREQ=DAILY;UNTIL=20261231", "FREQ=DAILY;UNTIL=20270101T045959Z", false},
+		{"FREQ=DAILY;UNTIL=20261231T190000Z", "FREQ=DAILY;UNTIL=20261231T190000Z", false},
+		{"FREQ=DAILY;COUNT=1000", "FREQ=DAILY;COUNT=1000", false},
+
+		{"INTERVAL=2", "", true},
+		{"FREQ=YEARLY", "", true},
+		{"FREQ=WEEKLY;BYSETPOS=1", "", true},
+		{"FREQ=WEEKLY;FREQ=DAILY", "", true},
+		{"FREQ=WEEKLY;INTERVAL=0", "", true},
+		{"FREQ=WEEKLY;INTERVAL=two", "", true},
+		{"FREQ=WEEKLY;BYDAY=MO,MO", "", true},
+		{"FREQ=MONTHLY;BYDAY=1MO,3MO", "", true},
+		{"FREQ=MONTHLY;BYDAY=0MO", "", true},
+		{"FREQ=MONTHLY;BYDAY=6MO", "", true},
+		{"FREQ=DAILY;BYDAY=1MO", "", true},
+		{"FREQ=MONTHLY;BYDAY=MO", "", true},
+		{"FREQ=DAILY;COUNT=1001", "", true},
+		{"FREQ=DAILY;UNTIL=tomorrow", "", true},
+		{"FREQ", "", true},
+	}
+
+	for _, c := range cases {
+		rule, err := ParseRRule(c.input, newYork)
+		if (err != nil) != c.wantErr {
+			t.Fatalf("%q: got error %v, want error %v", c.input, err, c.wantErr)
+		}
+		got := ""
+		if rule != nil {
+			got = rule.String()
+		}
+		if got != c.want {
+			t.Fatalf("%q: got %q, want %q", c.input, got, c.want)
+		}
+	}
+}
+
+func TestOccurrences(t *testing.T) {
+	newYork, _ := time.LoadLocation("America/New_York")
+	monday := time.Date(2026, time.October, 19, 19, 0, 0, 0, newYork)
+	utc := func(year int, month time.Month, day int, hour int) time.Time {
+		return time.Date(year, month, day, hour, 0, 0, 0, time.UTC)
+	}
+
+	cases := []struct {
+		name  string
+		rule  string
+		start time.Time
+		from  time.Time
+		to    time.Time
+		limit int
+		want  []time.Time
+	}{
+		{"weekly on several days", "FREQ=WEEKLY;BYDAY=MO,TH", monday, monday, time.Time{}, 4,
+			[]time.Time{utc(2026, 10, 19, 23), utc(2026, 10, 22, 23), utc(2026, 10, 26, 23), utc(2026, 10, 29, 23)}},
+		// Standard time starts on Nov 1, and the Event stays at 7pm in New York
+		{"across daylight saving", "FREQ=WEEKLY", monday.AddDate(0, 0, 7), monday, time.Time{}, 2,
+			[]time.Time{utc(2026, 10, 26, 23), utc(2026, 11, 3, 0)}},
+		{"until", "FREQ=DAILY;UNTIL=20261021", monday, monday, time.Time{}, 0,
+			[]time.Time{utc(2026, 10, 19, 23), utc(2026, 10, 20, 23), utc(2026, 10, 21, 23)}},
+		{"up to to", "FREQ=DAILY", monday, monday, time.Date(2026, 10, 22, 0, 0, 0, 0, newYork), 0,
+			[]time.Time{utc(2026, 10, 19, 23), utc(2026, 10, 20, 23), utc(2026, 10, 21, 23)}},
+		// Occurrences before from still count towards COUNT
+		{"count", "FREQ=DAILY;COUNT=3", monday, monday.Add(time.Hour), time.Time{}, 0,
+			[]time.Time{utc(2026, 10, 20, 23), utc(2026, 10, 21, 23)}},
+		{"skipping months without the day", "FREQ=MONTHLY", time.Date(2027, 1, 31, 19, 0, 0, 0, newYork),
+			time.Time{}, time.Time{}, 3,
+			[]time.Time{utc(2027, 2, 1, 0), utc(2027, 3, 31, 23), utc(2027, 5, 31, 23)}},
+		{"last weekday of the month", "FREQ=MONTHLY;BYDAY=-1FR", time.Date(2026, 10, 30, 19, 0, 0, 0, newYork),
+			time.Time{}, time.Time{}, 3,
+			[]time.Time{utc(2026, 10, 30, 23), utc(2026, 11, 28, 0), utc(2026, 12, 26, 0)}},
+		{"skipping ahead", "FREQ=WEEKLY", monday, time.Date(2030, 1, 1, 0, 0, 0, 0, newYork), time.Time{}, 1,
+			[]time.Time{utc(2030, 1, 8, 0)}},
+		{"skipping ahead every other week", "FREQ=WEEKLY;INTERVAL=2", monday,
+			time.Date(2026, 11, 3, 0, 0, 0, 0, newYork), time.Time{}, 1,
+			[]time.Time{utc(2026, 11, 17, 0)}},
+		{"ended", "FREQ=DAILY;COUNT=2", monday, monday.AddDate(0, 0, 2), time.Time{}, 0, nil},
+	}
+
+	for _, c := range cases {
+		rule, err := ParseRRule(c.rule, newYork)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		got := rule.Occurrences(c.start, newYork, c.from, c.to, c.limit)
+		if len(got) != len(c.want) {
+			t.Fatalf("%s: got %v, want %v", c.name, got, c.want)
+		}
+		for i := range got {
+			if !got[i].Equal(c.want[i]) {
+				t.Fatalf("%s: got %v, want %v", c.name, got, c.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+var (
+	// How long before an Event starts its RSVPs are reminded about it
+	REMINDER_OFFSETS []time.Duration = []time.Duration{24 * time.Hour, time.Hour}
+
+	// How often the scheduler checks for reminders that are due
+	reminderInterval = time.Minute
+)
+
+// A Reminder is a pending private message to the people going to an Event, sent at a set time before it starts
+// Recurring Events only have Reminders for their next occurrence at a time
+type Reminder struct {
+	id         int64
+	eventID    string
+	occurrence int64
+	remindAt   time.Time
+}
+
+// Replace any pending Reminders for an Event with new ones based on its current start time
+// For a recurring Event, this is the first occurrence that still has a reminder to send
+// Cancelled Events don't get any
+func ScheduleReminders(event *Event) error {
+	event = event.seriesEvent()
+	now := time.Now()
+	if event.status == EventCancelled {
+		return eventStore.ReplaceReminders(event.id, 0, nil)
+	}
+
+	occurrences, err := ExpandEvent(event, now, time.Time{}, 3)
+	if err != nil {
+		return err
+	}
+	var next *Event
+	for _, occurrence := range occurrences {
+		for _, offset := range REMINDER_OFFSETS {
+			if next == nil && occurrence.startsAt.Add(-offset).After(now) {
+				next = occurrence
+			}
+		}
+	}
+
+	if next == nil {
+		return eventStore.ReplaceReminders(event.id, 0, nil)
+	}
+	var remindAt []time.Time
+	for _, offset := range REMINDER_OFFSETS {
+		if next.startsAt.Add(-offset).After(now) {
+			remindAt = append(remindAt, next.startsAt.Add(-offset))
+		}
+	}
+	return eventStore.ReplaceReminders(event.id, next.occurrence, remindAt)
+}
+
+// Replace an Event's pending Reminders with ones for an occurrence at each of the given times
+func (store *SQLEventStore) ReplaceReminders(eventID int64, occurrence int64, remindAt []time.Time) error {
+	deleteStmt, err := store.prepare(`DELETE FROM reminders WHERE event_id=?`)
+	if err != nil {
+		return err
+	}
+	insertStmt, err := store.prepare(`INSERT INTO reminders (event_id, occurrence, remind_at) VALUES (?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+
+	tx, err := store.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Stmt(deleteStmt).Exec(eventID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	for _, t := range remindAt {
+		_, err = tx.Stmt(insertStmt).Exec(eventID, occurrence, t.Unix())
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	tx.Commit()
+	return nil
+}
+
+// Get all Reminders that should have been sent by now
+func (store *SQLEventStore) RetrieveDueReminders(now time.Time) ([]*Reminder, error) {
+	stmt, err := store.prepare(`SELECT id, event_id, occurrence, remind_at FROM reminders WHERE remind_at<=?
+        ORDER BY remind_at`)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := stmt.Query(now.Unix())
+	if err != nil {
+		return nil, err
+	}
+
+	var reminders []*Reminder
+
+	defer result.Close()
+	for result.Next() {
+		var reminder Reminder
+		var remindAt int64
+		err := result.Scan(&reminder.id, &reminder.eventID, &reminder.occurrence, &remindAt)
+		if err != nil {
+			return nil, err
+		}
+		reminder.remindAt = time.Unix(remindAt, 0).UTC()
+		reminders = append(reminders, &reminder)
+	}
+	err = result.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return reminders, nil
+}
+
+// Remove a Reminder from the DB once it has been sent
+func (store *SQLEventStore) DeleteReminder(id int64) error {
+	stmt, err := store.prepare(`DELETE FROM reminders WHERE id=?`)
+	if err != nil {
+		return err
+	}
+
+	_, err = stmt.Exec(id)
+	return err
+}
+
+// Periodically send any Reminders that are due and mark Events that are over as completed.  Reminders are kept in the
+// DB, so ones that came due while the bot was offline are sent as soon as it starts again, as long as their Event
+// hasn't already started.
+func RunReminderScheduler(s *discordgo.Session) {
+	ticker := time.NewTicker(reminderInterval)
+	defer ticker.Stop()
+
+	for {
+		now := time.Now()
+		sendDueReminders(s, now)
+		_, err := eventStore.CompletePastEvents(now)
+		if err != nil {
+			fmt.Println("Error completing past events: " + err.Error())
+		}
+		<-ticker.C
+	}
+}
+
+func sendDueReminders(s *discordgo.Session, now time.Time) {
+	reminders, err := eventStore.RetrieveDueReminders(now)
+	if err != nil {
+		fmt.Println("Error retrieving reminders: " + err.Error())
+		return
+	}
+
+	// Several reminders for the same occurrence can be due at once after the bot was offline, only send one
+	sent := make(map[string]bool)
+	var recurring []*Event
+
+	for _, reminder := range reminders {
+		event, err := eventStore.RetrieveEventByID(reminder.eventID)
+		if err == nil {
+			occurrence, err := RetrieveOccurrence(event, reminder.occurrence)
+			key := occurrenceKey(event.id, reminder.occurrence)
+			if err == nil && occurrence.startsAt.After(now) && !sent[key] {
+				sendReminder(s, occurrence, now)
+				sent[key] = true
+			}
+			if event.recurrence != nil {
+				recurring = append(recurring, event)
+			}
+		}
+
+		err = eventStore.DeleteReminder(reminder.id)
+		if err != nil {
+			fmt.Println("Error deleting reminder: " + err.Error())
+		}
+	}
+
+	// Queue up reminders for the next occurrence of any recurring Events that were just reminded about
+	for _, event := range recurring {
+		err := ScheduleReminders(event)
+		if err != nil {
+			fmt.Println("Error scheduling reminders: " + err.Error())
+		}
+	}
+}
+
+// Let everyone who is or might be going to an Event know that it is starting soon
+func sendReminder(s *discordgo.Session, event *Event, now time.Time) {
+	rsvps, err := eventStore.RetrieveRSVPs(strconv.FormatInt(event.id, 10), event.occurrence)
+	if err != nil {
+		fmt.Println("Error retrieving RSVPs for reminder: " + err.Error())
+		return
+	}
+
+	for _, rsvp := range rsvps {
+		if strings.Compare(rsvp.status, "Going") != 0 && strings.Compare(rsvp.status, "Maybe") != 0 {
+			continue
+		}
+		channel, err := s.UserChannelCreate(rsvp.userID)
+		if err != nil {
+			fmt.Println("Error creating private channel for reminder: " + err.Error())
+			continue
+		}
+		s.ChannelMessageSend(channel.ID,
+			"**Reminder:** "+event.name+" starts in "+formatDuration(event.startsAt.Sub(now))+".\n"+
+				"**When:** "+event.When()+"\n"+
+				"**Where:** "+event.location)
+	}
+}
+
+// Parse a comma separated list of durations such as "24h,1h" into reminder offsets
+func ParseReminderOffsets(input string) ([]time.Duration, error) {
+	var offsets []time.Duration
+	for _, field := range strings.Split(input, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		offset, err := time.ParseDuration(field)
+		if err != nil {
+			return nil, err
+		}
+		offsets = append(offsets, offset)
+	}
+	return offsets, nil
+}
+
+// Format a duration in the largest whole unit that fits, e.g. "2 days", "1 hour" or "45 minutes"
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Minute)
+	switch {
+	case d >= 48*time.Hour:
+		return pluralize(int64(d/(24*time.Hour)), "day")
+	case d >= time.Hour:
+		return pluralize(int64(d/time.Hour), "hour")
+	default:
+		return pluralize(int64(d/time.Minute), "minute")
+	}
+}
+
+func pluralize(n int64, unit string) string {
+	if n == 1 {
+		return "1 " + unit
+	}
+	return strconv.FormatInt(n, 10) + " " + unit + "s"
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Handle !repost commands
+func HandleRepostCommand(s *discordgo.Session, msg *discordgo.MessageCreate) {
+	splitIn := strings.SplitN(msg.Content, " ", 2)
+
+	if splitIn[0] != "!repost" {
+		return
+	}
+	ctx := NewMessageContext(s, msg)
+	if len(splitIn) != 2 {
+		repostHelpCommand(ctx)
+		return
+	}
+	splitCmd := strings.SplitN(strings.TrimSpace(splitIn[1]), " ", 2)
+	cmdKey := strings.ToLower(splitCmd[0])
+	var cmdBody string = ""
+	if len(splitCmd) == 2 {
+		cmdBody = strings.TrimSpace(splitCmd[1])
+	}
+
+	switch cmdKey {
+	case "status":
+		repostStatusCommand(ctx)
+
+	case "stats":
+		repostStatsCommand(ctx, strings.Fields(cmdBody))
+
+	case "settings":
+		repostSettingsCommand(ctx)
+
+	case "ignore", "unignore":
+		repostListCommand(ctx, "repost_ignored_channels", cmdKey == "ignore", cmdBody)
+
+	case "exempt", "unexempt":
+		repostListCommand(ctx, "repost_exempt_roles", cmdKey == "exempt", cmdBody)
+
+	case "allow", "disallow":
+		repostListCommand(ctx, "repost_allowed_domains", cmdKey == "allow", cmdBody)
+
+	case "window":
+		repostWindowCommand(ctx, cmdBody)
+
+	default:
+		repostHelpCommand(ctx)
+	}
+}
+
+// Show the user how long they can't post for after reposting, if they can't
+func repostStatusCommand(ctx *CommandContext) {
+	now := time.Now()
+	penalty, err := messageStore.RetrievePenalty(ctx.guildID, ctx.user.ID, now)
+	if err != nil {
+		fmt.Println("Error retrieving penalty: " + err.Error())
+		ctx.reply("I couldn't look up your penalty, try again later.")
+		return
+	}
+	if penalty == nil {
+		ctx.reply(ctx.user.Mention() + ", you can post freely.")
+		return
+	}
+
+	status := ctx.user.Mention() + ", you can't post for another " + formatDuration(penalty.expiresAt.Sub(now)) +
+		" (" + penalty.reason + ", " + formatDuration(now.Sub(penalty.startedAt)) + " ago)."
+	if UNLOCK_PHRASE != "" {
+		status += "  Say `" + UNLOCK_PHRASE + "` to lift it now."
+	}
+	ctx.reply(status)
+}
+
+// Show who reposts most, what gets reposted most, and how often a user reposts, over the last 30 days or a period
+// given as e.g. 90d or all.  The user is the one who asked unless someone else is mentioned.
+func repostStatsCommand(ctx *CommandContext, args []string) {
+	now := time.Now()
+	since := now.Add(-30 * 24 * time.Hour)
+	period := "in the last 30 days"
+	user := ctx.user.ID
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "<@") && strings.HasSuffix(arg, ">") {
+			user = strings.TrimPrefix(strings.TrimSuffix(strings.TrimPrefix(arg, "<@"), ">"), "!")
+		} else if strings.ToLower(arg) == "all" {
+			since = time.Time{}
+			period = "ever"
+		} else if duration, err := ParseLongDuration(arg); err == nil && duration > 0 {
+			since = now.Add(-duration)
+			period = "in the last " + formatDuration(duration)
+		} else {
+			ctx.reply("Usage: !repost stats [90d|all] [@user]")
+			return
+		}
+	}
+
+	stats, err := messageStore.RetrieveRepostStats(ctx.guildID, user, since, 5)
+	if err != nil {
+		ctx.reply(err.Error())
+		return
+	}
+
+	var buffer bytes.Buffer
+	buffer.WriteString("**Top reposters " + period + ":**\n")
+	if len(stats.topReposters) == 0 {
+		buffer.WriteString("Nobody has reposted anything.\n")
+	}
+	for i, reposter := range stats.topReposters {
+		buffer.WriteString(strconv.Itoa(i+1) + ". <@" + reposter.key + "> " + pluralize(reposter.count, "repost") + "\n")
+	}
+
+	buffer.WriteString("**Most reposted links " + period + ":**\n")
+	if len(stats.topLinks) == 0 {
+		buffer.WriteString("No links have been reposted.\n")
+	}
+	for i, link := range stats.topLinks {
+		// Angle brackets stop Discord embedding every link in the list
+		buffer.WriteString(strconv.Itoa(i+1) + ". <https://" + link.key + "> " + pluralize(link.count, "time") + "\n")
+	}
+
+	buffer.WriteString("<@" + user + "> reposted " + pluralize(stats.userReposts, "time") + " out of " +
+		pluralize(stats.userMessages, "message") + " " + period + ".")
+	ctx.replyQuietly(buffer.String())
+}
+
+// Show what the repost detector leaves alone on this server
+func repostSettingsCommand(ctx *CommandContext) {
+	settings, err := RetrieveRepostSettings(ctx.guildID)
+	if err != nil {
+		ctx.reply(err.Error())
+		return
+	}
+
+	describe := func(values []string, prefix string, suffix string) string {
+		if len(values) == 0 {
+			return "none"
+		}
+		return prefix + strings.Join(values, suffix+", "+prefix) + suffix
+	}
+	window := "never"
+	if settings.window > 0 {
+		window = "after " + formatDuration(settings.window)
+	}
+	ctx.reply("**Ignored channels:** " + describe(settings.ignoredChannels, "<#", ">") + "\n" +
+		"**Exempt roles:** " + describe(settings.exemptRoles, "<@&", ">") + "\n" +
+		"**Allowed domains:** " + describe(settings.allowedDomains, "", "") + "\n" +
+		"**Links and images can be posted again:** " + window)
+}
+
+// Add a channel, role or domain to one of the lists the repost detector leaves alone, or remove it
+func repostListCommand(ctx *CommandContext, columnName string, add bool, value string) {
+	if !canManageServer(ctx) {
+		ctx.reply("You need the Manage Server permission to change what counts as a repost.")
+		return
+	}
+
+	var ok bool
+	switch columnName {
+	case "repost_ignored_channels":
+		value = strings.TrimSuffix(strings.TrimPrefix(value, "<#"), ">")
+		channel, err := ctx.session.Channel(value)
+		ok = err == nil && channel.GuildID == ctx.guildID
+	case "repost_exempt_roles":
+		value = strings.TrimSuffix(strings.TrimPrefix(value, "<@&"), ">")
+		_, err := ctx.session.State.Role(ctx.guildID, value)
+		ok = err == nil
+	case "repost_allowed_domains":
+		value, ok = CanonicalDomain(value)
+	}
+	if !ok {
+		ctx.reply("I couldn't find that on this server.  Use a channel or role mention, or a domain like example.com.")
+		return
+	}
+
+	settings, err := RetrieveRepostSettings(ctx.guildID)
+	if err != nil {
+		ctx.reply(err.Error())
+		return
+	}
+	list := map[string][]string{
+		"repost_ignored_channels": settings.ignoredChannels,
+		"repost_exempt_roles":     settings.exemptRoles,
+		"repost_allowed_domains":  settings.allowedDomains,
+	}[columnName]
+
+	var updated []string
+	for _, existing := range list {
+		if existing != value {
+			updated = append(updated, existing)
+		}
+	}
+	if add {
+		updated = append(updated, value)
+	}
+
+	if err := UpdateRepostList(ctx.guildID, columnName, updated); err != nil {
+		ctx.reply(err.Error())
+		return
+	}
+	repostSettingsCommand(ctx)
+}
+
+// Change how long until a link or image can be posted again without it being a repost
+func repostWindowCommand(ctx *CommandContext, window string) {
+	if !canManageServer(ctx) {
+		ctx.reply("You need the Manage Server permission to change what counts as a repost.")
+		return
+	}
+
+	var duration time.Duration
+	if window != "never" && window != "off" {
+		var err error
+		duration, err = ParseLongDuration(window)
+		if err != nil || duration <= 0 {
+			ctx.reply("Usage: !repost window 90d, or !repost window never")
+			return
+		}
+	}
+
+	if err := UpdateRepostWindow(ctx.guildID, duration); err != nil {
+		ctx.reply(err.Error())
+		return
+	}
+	repostSettingsCommand(ctx)
+}
+
+func repostHelpCommand(ctx *CommandContext) {
+	ctx.reply("**Penalty:**           !repost status" + "\n" +
+		"**Leaderboard:**       !repost stats [90d|all] [@user]" + "\n" +
+		"**Settings:**          !repost settings" + "\n" +
+		"**Ignore channel:**    !repost ignore|unignore #channel" + "\n" +
+		"**Exempt role:**       !repost exempt|unexempt @role" + "\n" +
+		"**Allow domain:**      !repost allow|disallow example.com" + "\n" +
+		"**Repost window:**     !repost window 90d|never")
+}
+
+// Parse a duration such as "90d", "2w" or "36h", which can be in days or weeks as well as the units
+// time.ParseDuration accepts
+func ParseLongDuration(input string) (time.Duration, error) {
+	input = strings.TrimSpace(input)
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if strings.HasSuffix(input, suffix) {
+			n, err := strconv.Atoi(strings.TrimSuffix(input, suffix))
+			if err != nil {
+				return 0, err
+			}
+			return time.Duration(n) * unit, nil
+		}
+	}
+	return time.ParseDuration(input)
+}
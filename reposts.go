@@ -0,0 +1,391 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+var (
+	// How long someone who reposts can't post for
+	REPOST_PENALTY time.Duration = time.Hour
+
+	// What someone can say to lift their penalty early, or empty if penalties can only run out
+	UNLOCK_PHRASE string = "I am a filthy reposter."
+)
+
+// A Penalty stops someone posting in a guild for a while after they reposted something
+// Their messages are deleted until it expires or is lifted
+type Penalty struct {
+	id               int64
+	guildID          string
+	userID           string
+	reason           string
+	channelID        string // where the message that triggered the Penalty was posted
+	discordMessageID string
+	startedAt        time.Time
+	expiresAt        time.Time
+}
+
+// A RepostIncident is a time someone was caught reposting, kept for !repost stats
+type RepostIncident struct {
+	guildID          string
+	userID           string
+	channelID        string
+	discordMessageID string
+	originalAuthorID string
+	url              string // the canonical form of the link that was reposted, or empty for an image
+	repostedAt       time.Time
+}
+
+// How many reposts a user or link accounts for
+type RepostCount struct {
+	key   string // a user ID or a canonical link
+	count int64
+}
+
+// RepostStats are a guild's repost numbers since some time
+type RepostStats struct {
+	topReposters []RepostCount
+	topLinks     []RepostCount
+	userReposts  int64 // how many times the user asking reposted something
+	userMessages int64 // how many messages the user asking posted
+}
+
+// Check a message for links and images that have already been posted in its guild, penalizing whoever reposted them,
+// and record it so later reposts of it are caught.  Messages from someone with a Penalty are deleted instead.
+// Channels the guild has told the detector to ignore are left alone entirely.
+func CheckForReposts(s *discordgo.Session, msg *discordgo.MessageCreate) {
+	if msg.Author.Bot {
+		// The bot quotes links to the originals, which would otherwise count as reposts of them
+		return
+	}
+	now := time.Now()
+
+	settings, err := RetrieveRepostSettings(msg.GuildID)
+	if err != nil {
+		fmt.Println("Error retrieving repost settings: " + err.Error())
+		settings = &RepostSettings{}
+	}
+	for _, channelID := range settings.ignoredChannels {
+		if channelID == msg.ChannelID {
+			return
+		}
+	}
+
+	if UNLOCK_PHRASE != "" && strings.Compare(msg.Content, UNLOCK_PHRASE) == 0 {
+		_, err := messageStore.LiftPenalties(msg.GuildID, msg.Author.ID, now)
+		if err != nil {
+			fmt.Println("Error lifting penalties: " + err.Error())
+		}
+	}
+
+	penalty, err := messageStore.RetrievePenalty(msg.GuildID, msg.Author.ID, now)
+	if err != nil {
+		fmt.Println("Error retrieving penalty: " + err.Error())
+	}
+	if penalty != nil {
+		s.ChannelMessageDelete(msg.ChannelID, msg.ID)
+		return
+	}
+
+	postedAt := msg.Timestamp
+	if postedAt.IsZero() {
+		postedAt = now
+	}
+	message := Message{
+		guildID:          msg.GuildID,
+		channelID:        msg.ChannelID,
+		discordMessageID: msg.ID,
+		authorID:         msg.Author.ID,
+		content:          msg.Content,
+		postedAt:         postedAt,
+		urls:             CanonicalURLs(msg.Content),
+		imageHashes:      HashImageAttachments(msg.Attachments),
+	}
+
+	if isRepostExempt(msg.Member, settings) {
+		messageStore.RecordMessage(&message)
+		return
+	}
+
+	var since time.Time
+	if settings.window > 0 {
+		since = now.Add(-settings.window)
+	}
+	var urls []string
+	for _, url := range message.urls {
+		if !OnDomain(url, settings.allowedDomains) {
+			urls = append(urls, url)
+		}
+	}
+
+	var original *Message
+	reason := ""
+	if len(urls) > 0 {
+		original, err = messageStore.DetectRepost(msg.GuildID, urls, since)
+		if err != nil {
+			fmt.Println("Error checking for reposts: " + err.Error())
+		} else if original != nil {
+			reason = "Reposted a link"
+		}
+	}
+	if len(message.imageHashes) > 0 && original == nil {
+		original, err = messageStore.DetectImageRepost(msg.GuildID, message.imageHashes, IMAGE_REPOST_DISTANCE, since)
+		if err != nil {
+			fmt.Println("Error checking for image reposts: " + err.Error())
+		} else if original != nil {
+			reason = "Reposted an image"
+		}
+	}
+	if original != nil {
+		incident := RepostIncident{
+			guildID:          msg.GuildID,
+			userID:           msg.Author.ID,
+			channelID:        msg.ChannelID,
+			discordMessageID: msg.ID,
+			originalAuthorID: original.authorID,
+			url:              firstShared(urls, original.urls),
+			repostedAt:       postedAt,
+		}
+		if err := messageStore.RecordRepost(&incident); err != nil {
+			fmt.Println("Error recording repost: " + err.Error())
+		}
+
+		if original.discordMessageID != "" {
+			reason += " from " + original.Link()
+		}
+		callout := describeRepost(original, now)
+		if warning := penaltyWarning(); warning != "" {
+			callout += "\n" + warning
+		}
+		// The original poster did nothing wrong, so they are named without being pinged
+		s.ChannelMessageSendComplex(msg.ChannelID, &discordgo.MessageSend{
+			Content:         callout,
+			AllowedMentions: &discordgo.MessageAllowedMentions{},
+		})
+	}
+
+	if reason != "" && REPOST_PENALTY > 0 {
+		err = messageStore.CreatePenalty(&Penalty{
+			guildID:          msg.GuildID,
+			userID:           msg.Author.ID,
+			reason:           reason,
+			channelID:        msg.ChannelID,
+			discordMessageID: msg.ID,
+			startedAt:        now,
+			expiresAt:        now.Add(REPOST_PENALTY),
+		})
+		if err != nil {
+			fmt.Println("Error creating penalty: " + err.Error())
+		}
+	}
+
+	messageStore.RecordMessage(&message)
+}
+
+// Find the first link in urls that is also in others, or an empty string if there isn't one
+func firstShared(urls []string, others []string) string {
+	for _, url := range urls {
+		for _, other := range others {
+			if url == other {
+				return url
+			}
+		}
+	}
+	return ""
+}
+
+// Check whether a member has a role that lets them post anything
+func isRepostExempt(member *discordgo.Member, settings *RepostSettings) bool {
+	if member == nil {
+		return false
+	}
+	for _, role := range member.Roles {
+		for _, exempt := range settings.exemptRoles {
+			if role == exempt {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Point to what a repost is a repost of: a link to it, who posted it and how long ago.  Messages recorded before
+// they were linked to Discord only have who posted them.
+func describeRepost(original *Message, now time.Time) string {
+	description := "Repost"
+	if original.discordMessageID != "" {
+		description += " of " + original.Link()
+	}
+	if original.authorID != "" {
+		description += ", first posted by <@" + original.authorID + ">"
+		if !original.postedAt.IsZero() {
+			description += " " + formatDuration(now.Sub(original.postedAt)) + " ago"
+		}
+	}
+	return description + "."
+}
+
+// Tell a reposter how long they can't post for and how to lift it early
+func penaltyWarning() string {
+	if REPOST_PENALTY <= 0 {
+		return ""
+	}
+	warning := "You have been banned from posting for " + formatDuration(REPOST_PENALTY)
+	if UNLOCK_PHRASE != "" {
+		warning += ", or until you say `" + UNLOCK_PHRASE + "`"
+	}
+	return warning + "."
+}
+
+// Stop someone posting in a guild until a Penalty expires
+func (store *SQLMessageStore) CreatePenalty(penalty *Penalty) error {
+	stmt, err := store.prepareInsert(`INSERT INTO penalties (guild_id, user_id, reason, channel_id,
+        discord_message_id, started_at, expires_at) VALUES (?,?,?,?,?,?,?)`)
+	if err != nil {
+		return err
+	}
+
+	tx, err := store.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	id, err := store.insert(tx, stmt, penalty.guildID, penalty.userID, penalty.reason, penalty.channelID,
+		penalty.discordMessageID, penalty.startedAt.Unix(), penalty.expiresAt.Unix())
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	penalty.id = id
+	return nil
+}
+
+// Get the Penalty a user has in a guild that hasn't expired or been lifted by now
+// Returns nil if they can post.  If they somehow have several, the one that lasts longest is returned.
+func (store *SQLMessageStore) RetrievePenalty(guildID string, userID string, now time.Time) (*Penalty, error) {
+	stmt, err := store.prepare(`SELECT id, guild_id, user_id, reason, channel_id, discord_message_id, started_at,
+        expires_at FROM penalties WHERE guild_id = ? AND user_id = ? AND expires_at > ? AND lifted_at = 0
+        ORDER BY expires_at DESC LIMIT 1`)
+	if err != nil {
+		return nil, err
+	}
+
+	var penalty Penalty
+	var startedAt, expiresAt int64
+	err = stmt.QueryRow(guildID, userID, now.Unix()).Scan(&penalty.id, &penalty.guildID, &penalty.userID,
+		&penalty.reason, &penalty.channelID, &penalty.discordMessageID, &startedAt, &expiresAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	penalty.startedAt = time.Unix(startedAt, 0)
+	penalty.expiresAt = time.Unix(expiresAt, 0)
+	return &penalty, nil
+}
+
+// Lift a user's Penalties in a guild early
+// Returns how many were lifted
+func (store *SQLMessageStore) LiftPenalties(guildID string, userID string, now time.Time) (int64, error) {
+	stmt, err := store.prepare(`UPDATE penalties SET lifted_at = ?
+        WHERE guild_id = ? AND user_id = ? AND expires_at > ? AND lifted_at = 0`)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := stmt.Exec(now.Unix(), guildID, userID, now.Unix())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// Log that someone was caught reposting
+func (store *SQLMessageStore) RecordRepost(incident *RepostIncident) error {
+	stmt, err := store.prepare(`INSERT INTO repost_incidents (guild_id, user_id, channel_id, discord_message_id,
+        original_author_id, url, reposted_at) VALUES (?,?,?,?,?,?,?)`)
+	if err != nil {
+		return err
+	}
+
+	_, err = stmt.Exec(incident.guildID, incident.userID, incident.channelID, incident.discordMessageID,
+		incident.originalAuthorID, incident.url, incident.repostedAt.Unix())
+	return err
+}
+
+// Count a guild's reposts since a time: the limit users who reposted most and links reposted most, and how many
+// messages userID posted and how many of them were reposts
+func (store *SQLMessageStore) RetrieveRepostStats(guildID string, userID string, since time.Time,
+	limit int) (*RepostStats, error) {
+	var stats RepostStats
+	var err error
+
+	stats.topReposters, err = store.countReposts(`SELECT user_id, COUNT(*) AS reposts FROM repost_incidents
+        WHERE guild_id = ? AND reposted_at >= ? GROUP BY user_id ORDER BY reposts DESC, user_id LIMIT ?`,
+		guildID, since.Unix(), limit)
+	if err != nil {
+		return nil, err
+	}
+	stats.topLinks, err = store.countReposts(`SELECT url, COUNT(*) AS reposts FROM repost_incidents
+        WHERE guild_id = ? AND reposted_at >= ? AND url <> '' GROUP BY url ORDER BY reposts DESC, url LIMIT ?`,
+		guildID, since.Unix(), limit)
+	if err != nil {
+		return nil, err
+	}
+
+	stmt, err := store.prepare(`SELECT COUNT(*) FROM repost_incidents
+        WHERE guild_id = ? AND user_id = ? AND reposted_at >= ?`)
+	if err != nil {
+		return nil, err
+	}
+	err = stmt.QueryRow(guildID, userID, since.Unix()).Scan(&stats.userReposts)
+	if err != nil {
+		return nil, err
+	}
+
+	stmt, err = store.prepare(`SELECT COUNT(*) FROM messages WHERE guild_id = ? AND author_id = ? AND posted_at >= ?`)
+	if err != nil {
+		return nil, err
+	}
+	err = stmt.QueryRow(guildID, userID, since.Unix()).Scan(&stats.userMessages)
+	if err != nil {
+		return nil, err
+	}
+
+	return &stats, nil
+}
+
+// Run a query that counts reposts by user or link
+func (store *SQLMessageStore) countReposts(query string, args ...interface{}) ([]RepostCount, error) {
+	stmt, err := store.prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	result, err := stmt.Query(args...)
+	if err != nil {
+		return nil, err
+	}
+	defer result.Close()
+
+	var counts []RepostCount
+	for result.Next() {
+		var count RepostCount
+		err = result.Scan(&count.key, &count.count)
+		if err != nil {
+			return nil, err
+		}
+		counts = append(counts, count)
+	}
+	return counts, result.Err()
+}
@@ -0,0 +1,508 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Discord shows at most this many autocomplete suggestions
+const maxAutocompleteChoices = 25
+
+var (
+	dmPermission = false
+
+	// The event option used by every subcommand that acts on an existing Event
+	eventOption = &discordgo.ApplicationCommandOption{
+		Type:         discordgo.ApplicationCommandOptionString,
+		Name:         "event",
+		Description:  "The event's ID or name",
+		Required:     true,
+		Autocomplete: true,
+	}
+	dateOption = &discordgo.ApplicationCommandOption{
+		Type:        discordgo.ApplicationCommandOptionString,
+		Name:        "date",
+		Description: "For a repeating event, the date of the occurrence, e.g. oct 21",
+	}
+
+	// The /event edit option for each field !event edit can change, in the order the changes are made
+	editOptionFields = []struct{ option, field string }{
+		{"name", "name"},
+		{"description", "description"},
+		{"append", "description+"},
+		{"location", "location"},
+		{"new-date", "date"},
+		{"new-time", "time"},
+		{"max", "max"},
+		{"repeat", "repeat"},
+	}
+
+	// The /event command, with one subcommand for each prefix command
+	eventCommand = &discordgo.ApplicationCommand{
+		Name:         "event",
+		Description:  "Plan events and RSVP to them",
+		DMPermission: &dmPermission,
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "create",
+				Description: "Create an event",
+				Options: []*discordgo.ApplicationCommandOption{
+					{Type: discordgo.ApplicationCommandOptionString, Name: "name", Description: "What's happening",
+						Required: true},
+					{Type: discordgo.ApplicationCommandOptionString, Name: "description",
+						Description: "More details about the event", Required: true},
+					{Type: discordgo.ApplicationCommandOptionString, Name: "location", Description: "Where it is",
+						Required: true},
+					{Type: discordgo.ApplicationCommandOptionString, Name: "date",
+						Description: "e.g. 2026-10-21, oct 21, tomorrow or next friday", Required: true},
+					{Type: discordgo.ApplicationCommandOptionString, Name: "time",
+						Description: "e.g. 7pm or 19:30", Required: true},
+					{Type: discordgo.ApplicationCommandOptionInteger, Name: "max",
+						Description: "Most people who can go, 0 for no limit"},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "info",
+				Description: "Show an event and who is going",
+				Options:     []*discordgo.ApplicationCommandOption{eventOption, dateOption},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "rsvp",
+				Description: "Say whether you're going to an event",
+				Options: []*discordgo.ApplicationCommandOption{
+					eventOption,
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "choice",
+						Description: "Are you going?",
+						Required:    true,
+						Choices: []*discordgo.ApplicationCommandOptionChoice{
+							{Name: "Going", Value: "Going"},
+							{Name: "Maybe", Value: "Maybe"},
+							{Name: "Not going", Value: "Not going"},
+						},
+					},
+					dateOption,
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "edit",
+				Description: "Change an event you created or co-host",
+				Options: []*discordgo.ApplicationCommandOption{
+					eventOption,
+					{Type: discordgo.ApplicationCommandOptionString, Name: "name", Description: "A new name"},
+					{Type: discordgo.ApplicationCommandOptionString, Name: "description",
+						Description: "A new description"},
+					{Type: discordgo.ApplicationCommandOptionString, Name: "append",
+						Description: "An update to add to the description"},
+					{Type: discordgo.ApplicationCommandOptionString, Name: "location", Description: "A new location"},
+					{Type: discordgo.ApplicationCommandOptionString, Name: "new-date",
+						Description: "Move it to another day, e.g. oct 21 or next friday"},
+					{Type: discordgo.ApplicationCommandOptionString, Name: "new-time",
+						Description: "Move it to another time of day, e.g. 7pm or 19:30"},
+					{Type: discordgo.ApplicationCommandOptionString, Name: "max",
+						Description: "Most people who can go, 0 for no limit"},
+					{Type: discordgo.ApplicationCommandOptionString, Name: "repeat",
+						Description: "e.g. weekly on mon,thu until dec 31, or never"},
+					dateOption,
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "cancel",
+				Description: "Cancel an event you created or co-host",
+				Options: []*discordgo.ApplicationCommandOption{
+					eventOption,
+					dateOption,
+					{Type: discordgo.ApplicationCommandOptionString, Name: "reason",
+						Description: "Why it was cancelled, shown to the people going"},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "restore",
+				Description: "Undo cancelling an event you created or co-host",
+				Options:     []*discordgo.ApplicationCommandOption{eventOption},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "history",
+				Description: "See who created, changed and RSVPed to an event",
+				Options:     []*discordgo.ApplicationCommandOption{eventOption},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "list",
+				Description: "List events",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "when",
+						Description: "Upcoming or past events",
+						Choices: []*discordgo.ApplicationCommandOptionChoice{
+							{Name: "Upcoming", Value: "upcoming"},
+							{Name: "Past", Value: "past"},
+						},
+					},
+					{Type: discordgo.ApplicationCommandOptionBoolean, Name: "mine",
+						Description: "Only events you created"},
+					{Type: discordgo.ApplicationCommandOptionBoolean, Name: "rsvp",
+						Description: "Only events you're going to"},
+					{Type: discordgo.ApplicationCommandOptionInteger, Name: "page", Description: "Page number"},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "ics",
+				Description: "Download an event as a calendar file",
+				Options:     []*discordgo.ApplicationCommandOption{eventOption},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "import",
+				Description: "Create events from a calendar (.ics) file",
+				Options: []*discordgo.ApplicationCommandOption{
+					{Type: discordgo.ApplicationCommandOptionAttachment, Name: "file",
+						Description: "The .ics file", Required: true},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "timezone",
+				Description: "Show or change the timezone new events use",
+				Options: []*discordgo.ApplicationCommandOption{
+					{Type: discordgo.ApplicationCommandOptionString, Name: "timezone",
+						Description: "e.g. America/New_York"},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "channel",
+				Description: "Show or change the channel new events are announced in",
+				Options: []*discordgo.ApplicationCommandOption{
+					{Type: discordgo.ApplicationCommandOptionChannel, Name: "channel",
+						Description:  "Where to announce events",
+						ChannelTypes: []discordgo.ChannelType{discordgo.ChannelTypeGuildText}},
+					{Type: discordgo.ApplicationCommandOptionBoolean, Name: "off",
+						Description: "Stop announcing events"},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "feed",
+				Description: "Get the link to subscribe to this server's events, or change it",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "action",
+						Description: "Turn the feed on or off, or give it a new link",
+						Choices: []*discordgo.ApplicationCommandOptionChoice{
+							{Name: "On", Value: "on"},
+							{Name: "New link", Value: "reset"},
+							{Name: "Off", Value: "off"},
+						},
+					},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "cohost",
+				Description: "Let someone edit and cancel an event you manage, or stop them",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "action",
+						Description: "Add or remove a co-host",
+						Required:    true,
+						Choices: []*discordgo.ApplicationCommandOptionChoice{
+							{Name: "Add", Value: "add"},
+							{Name: "Remove", Value: "remove"},
+						},
+					},
+					eventOption,
+					{Type: discordgo.ApplicationCommandOptionUser, Name: "user", Description: "The co-host",
+						Required: true},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "transfer",
+				Description: "Give an event to someone else",
+				Options: []*discordgo.ApplicationCommandOption{
+					eventOption,
+					{Type: discordgo.ApplicationCommandOptionUser, Name: "user", Description: "The new owner",
+						Required: true},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "managers",
+				Description: "Show or change the roles that can manage every event",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "action",
+						Description: "Add or remove a role",
+						Choices: []*discordgo.ApplicationCommandOptionChoice{
+							{Name: "Add", Value: "add"},
+							{Name: "Remove", Value: "remove"},
+						},
+					},
+					{Type: discordgo.ApplicationCommandOptionRole, Name: "role", Description: "The role"},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "help",
+				Description: "Show how to use the event planner",
+			},
+		},
+	}
+)
+
+// Register the slash commands with Discord, replacing any that were registered before
+func RegisterSlashCommands(s *discordgo.Session) error {
+	_, err := s.ApplicationCommandBulkOverwrite(s.State.User.ID, "", []*discordgo.ApplicationCommand{eventCommand})
+	return err
+}
+
+func HandleInteractionCreate(s *discordgo.Session, interaction *discordgo.InteractionCreate) {
+	switch interaction.Type {
+	case discordgo.InteractionApplicationCommand:
+		if interaction.ApplicationCommandData().Name == eventCommand.Name {
+			go HandleEventCommand(s, interaction.Interaction)
+		}
+	case discordgo.InteractionApplicationCommandAutocomplete:
+		if interaction.ApplicationCommandData().Name == eventCommand.Name {
+			go HandleEventAutocomplete(s, interaction.Interaction)
+		}
+	}
+}
+
+// Run an /event subcommand.  Its replies are only shown to the user who ran it.
+func HandleEventCommand(s *discordgo.Session, interaction *discordgo.Interaction) {
+	// Commands can take longer than the 3 seconds Discord waits for a response, so acknowledge this one first
+	err := s.InteractionRespond(interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{Flags: discordgo.MessageFlagsEphemeral},
+	})
+	if err != nil {
+		fmt.Println("Error responding to interaction: " + err.Error())
+		return
+	}
+
+	ctx := NewInteractionContext(s, interaction)
+	data := interaction.ApplicationCommandData()
+	if len(data.Options) == 0 {
+		helpCommand(ctx)
+		return
+	}
+	subcommand := data.Options[0]
+	options := make(map[string]*discordgo.ApplicationCommandInteractionDataOption)
+	for _, option := range subcommand.Options {
+		options[option.Name] = option
+	}
+
+	switch subcommand.Name {
+	case "create":
+		max := ""
+		if option, ok := options["max"]; ok {
+			max = strconv.FormatInt(option.IntValue(), 10)
+		}
+		createEventCommand(ctx, optionString(options, "name"), optionString(options, "description"),
+			optionString(options, "location"), optionString(options, "date"), optionString(options, "time"), max)
+
+	case "info":
+		infoCommand(ctx, optionString(options, "event"), optionString(options, "date"))
+
+	case "rsvp":
+		rsvpCommand(ctx, optionString(options, "event"), optionString(options, "date"),
+			optionString(options, "choice"))
+
+	case "edit":
+		var edits []FieldEdit
+		for _, editOption := range editOptionFields {
+			if option, ok := options[editOption.option]; ok {
+				edits = append(edits, FieldEdit{editOption.field, option.StringValue()})
+			}
+		}
+		if len(edits) == 0 {
+			ctx.reply("Choose at least one thing to change.")
+			return
+		}
+		editCommand(ctx, optionString(options, "event"), optionString(options, "date"), edits)
+
+	case "cancel":
+		cancelCommand(ctx, optionString(options, "event"), optionString(options, "date"),
+			optionString(options, "reason"))
+
+	case "restore":
+		restoreCommand(ctx, optionString(options, "event"))
+
+	case "history":
+		historyCommand(ctx, optionString(options, "event"))
+
+	case "list":
+		filter := EventFilter{guildID: ctx.guildID, past: optionString(options, "when") == "past"}
+		if option, ok := options["mine"]; ok && option.BoolValue() {
+			filter.creatorID = ctx.user.ID
+		}
+		if option, ok := options["rsvp"]; ok && option.BoolValue() {
+			filter.rsvpUserID = ctx.user.ID
+		}
+		page := 1
+		if option, ok := options["page"]; ok && option.IntValue() > 1 {
+			page = int(option.IntValue())
+		}
+		listCommand(ctx, filter, page)
+
+	case "ics":
+		icsCommand(ctx, optionString(options, "event"))
+
+	case "import":
+		var attachment *discordgo.MessageAttachment
+		if option, ok := options["file"]; ok && data.Resolved != nil {
+			attachment = data.Resolved.Attachments[option.Value.(string)]
+		}
+		importCommand(ctx, attachment)
+
+	case "timezone":
+		timezoneCommand(ctx, optionString(options, "timezone"))
+
+	case "channel":
+		channelID := ""
+		if option, ok := options["channel"]; ok {
+			channelID = option.Value.(string)
+		}
+		if option, ok := options["off"]; ok && option.BoolValue() {
+			channelID = "none"
+		}
+		channelCommand(ctx, channelID)
+
+	case "feed":
+		feedCommand(ctx, optionString(options, "action"))
+
+	case "cohost":
+		userID := ""
+		if option, ok := options["user"]; ok {
+			userID = option.Value.(string)
+		}
+		cohostCommand(ctx, optionString(options, "action"), optionString(options, "event"), userID)
+
+	case "transfer":
+		userID := ""
+		if option, ok := options["user"]; ok {
+			userID = option.Value.(string)
+		}
+		transferCommand(ctx, optionString(options, "event"), userID)
+
+	case "managers":
+		roleID := ""
+		if option, ok := options["role"]; ok {
+			roleID = option.Value.(string)
+		}
+		managersCommand(ctx, optionString(options, "action"), roleID)
+
+	default:
+		helpCommand(ctx)
+	}
+}
+
+// Suggest Events whose names match what the user has typed so far into an event option
+func HandleEventAutocomplete(s *discordgo.Session, interaction *discordgo.Interaction) {
+	var typed string
+	data := interaction.ApplicationCommandData()
+	if len(data.Options) > 0 {
+		for _, option := range data.Options[0].Options {
+			if option.Focused {
+				typed, _ = option.Value.(string)
+			}
+		}
+	}
+
+	events, err := eventStore.RetrieveEventByName(interaction.GuildID, typed)
+	if err != nil {
+		fmt.Println("Error retrieving events for autocomplete: " + err.Error())
+	}
+
+	choices := []*discordgo.ApplicationCommandOptionChoice{}
+	for _, event := range events {
+		if len(choices) == maxAutocompleteChoices {
+			break
+		}
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{
+			Name:  autocompleteName(event.name + " (" + event.LocalTime().Format("Jan 2 2006") + ")"),
+			Value: strconv.FormatInt(event.id, 10),
+		})
+	}
+
+	err = s.InteractionRespond(interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{Choices: choices},
+	})
+	if err != nil {
+		fmt.Println("Error responding to autocomplete: " + err.Error())
+	}
+}
+
+// Build the CommandContext for a slash command, whose replies are follow-ups only the user who ran it can see
+func NewInteractionContext(s *discordgo.Session, interaction *discordgo.Interaction) *CommandContext {
+	user := interaction.User
+	if interaction.Member != nil {
+		user = interaction.Member.User
+	}
+
+	followup := func(params *discordgo.WebhookParams) {
+		params.Flags = discordgo.MessageFlagsEphemeral
+		_, err := s.FollowupMessageCreate(interaction, true, params)
+		if err != nil {
+			fmt.Println("Error replying to interaction: " + err.Error())
+		}
+	}
+
+	return &CommandContext{
+		session:   s,
+		guildID:   interaction.GuildID,
+		channelID: interaction.ChannelID,
+		user:      user,
+		member:    interaction.Member,
+		reply: func(content string) {
+			followup(&discordgo.WebhookParams{Content: content})
+		},
+		replyQuietly: func(content string) {
+			followup(&discordgo.WebhookParams{Content: content, AllowedMentions: &discordgo.MessageAllowedMentions{}})
+		},
+		private: func(content string) {
+			followup(&discordgo.WebhookParams{Content: content})
+		},
+		replyFile: func(name string, content io.Reader) {
+			followup(&discordgo.WebhookParams{Files: []*discordgo.File{
+				{Name: name, Reader: content},
+			}})
+		},
+	}
+}
+
+// The value of a string option, or an empty string if it wasn't given
+func optionString(options map[string]*discordgo.ApplicationCommandInteractionDataOption, name string) string {
+	if option, ok := options[name]; ok {
+		return option.StringValue()
+	}
+	return ""
+}
+
+// Autocomplete choice names are limited to 100 characters
+func autocompleteName(name string) string {
+	runes := []rune(name)
+	if len(runes) > 100 {
+		return string(runes[:99]) + "…"
+	}
+	return name
+}
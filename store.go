@@ -0,0 +1,152 @@
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	// Where Events, RSVPs, Reminders and guild settings are kept
+	eventStore EventStore
+
+	// Where messages are recorded for repost detection
+	messageStore MessageStore
+)
+
+// An EventStore keeps Events and everything attached to them: RSVPs, changes to occurrences, pending Reminders, and
+// each guild's settings.  Lookups for something that doesn't exist return sql.ErrNoRows, whatever the backend.
+type EventStore interface {
+	// Create a new Event in a guild and return a pointer to it
+	CreateEvent(guildID, name, description, location string, startsAt time.Time, timezone string,
+		maxAttendees int64, creator, creatorID string) (*Event, error)
+	// Create a recurring Event with some of its occurrences already cancelled, so either all of it is created or none
+	// of it is
+	CreateSeries(guildID, name, description, location string, startsAt time.Time, timezone string,
+		maxAttendees int64, creator, creatorID string, rule *Recurrence, cancelled []int64) (*Event, error)
+	// Get an Event using its unique ID, whichever guild it is in and even if it was cancelled
+	RetrieveEventByID(id string) (*Event, error)
+	// Get the Event that was announced in a message
+	RetrieveEventByAnnouncement(messageID string) (*Event, error)
+	// Get the Events in a guild whose names contain name, ignoring case, leaving out cancelled ones like every
+	// search and list below
+	RetrieveEventByName(guildID string, name string) ([]*Event, error)
+	// Get the Events in a guild with exactly this name and start time
+	RetrieveEventByNameAndStart(guildID string, name string, startsAt time.Time) ([]*Event, error)
+	// Get the Events matching a filter that don't repeat, upcoming ones soonest first or past ones most recent
+	// first, up to limit of them.  A limit of 0 means no limit.
+	RetrieveSingleEvents(filter EventFilter, now time.Time, limit int) ([]*Event, error)
+	// Get the recurring Events matching a filter, whether or not they have occurrences left
+	RetrieveSeries(filter EventFilter) ([]*Event, error)
+	// Move Events that don't belong to a guild into one, returning how many were moved
+	AssignUnscopedEvents(guildID string) (int64, error)
+	// Mark an Event as cancelled, removing its pending Reminders but keeping everything else so it can be restored
+	CancelEvent(id string, reason string, cancelledAt time.Time, userID string) error
+	// Put a cancelled Event back on the schedule
+	RestoreEvent(id string, userID string) error
+	// Mark the Events that don't repeat and have started by now as completed, returning how many were
+	CompletePastEvents(now time.Time) (int64, error)
+	// Change columns of an Event, using the values the events table stores for them.  Either all of the changes are
+	// made or none are, and they are recorded in the Event's history unless editorID is empty.
+	UpdateEventColumns(id string, changes []ColumnChange, editorID string) error
+
+	// Create an RSVP, putting a Going RSVP on the waitlist if the Event is full
+	CreateRSVP(eventID string, occurrence int64, username string, userID string, status string) (*RSVP, error)
+	// Change an RSVP's status, putting a change to Going on the waitlist if the Event is full
+	UpdateRSVP(id string, status string) (*RSVP, error)
+	// Move people off an Event's waitlist until it is full again, returning the RSVPs that were promoted
+	PromoteWaitlist(eventID string, occurrence int64) ([]*RSVP, error)
+	// Get the RSVPs to an Event, or to one occurrence of a recurring Event
+	RetrieveRSVPs(eventID string, occurrence int64) ([]*RSVP, error)
+	// Get the RSVPs to every occurrence of an Event
+	RetrieveAllRSVPs(eventID string) ([]*RSVP, error)
+	// Get every RSVP where a user is going or might be going
+	RetrieveUserRSVPs(userID string) ([]*RSVP, error)
+
+	// Get the changes to a recurring Event's occurrences, keyed by occurrence
+	RetrieveEventExceptions(eventID int64) (map[int64]*EventException, error)
+	// Change columns of one occurrence of a recurring Event, using the values event_exceptions stores for them.
+	// Either all of the changes are made or none are, and they are recorded in the Event's history unless editorID is
+	// empty.
+	UpdateOccurrenceColumns(eventID int64, occurrence int64, changes []ColumnChange, editorID string) error
+	// Get the most recent limit changes to an Event and its RSVPs, oldest first
+	RetrieveHistory(eventID int64, limit int) ([]*AuditEntry, error)
+
+	// Replace an Event's pending Reminders with ones for an occurrence at each of the given times
+	ReplaceReminders(eventID int64, occurrence int64, remindAt []time.Time) error
+	// Get all Reminders that should have been sent by now, earliest first
+	RetrieveDueReminders(now time.Time) ([]*Reminder, error)
+	// Remove a Reminder once it has been sent
+	DeleteReminder(id int64) error
+
+	// Let a user manage an Event as if they had created it
+	AddCohost(eventID int64, userID string, addedBy string) error
+	// Stop a user managing an Event they co-host
+	RemoveCohost(eventID int64, userID string, removedBy string) error
+	// Get the IDs of the users who co-host an Event
+	RetrieveCohosts(eventID int64) ([]string, error)
+	// Make someone else an Event's creator, dropping them from its co-hosts if they were one
+	TransferEvent(eventID int64, creator string, creatorID string, transferredBy string) error
+
+	// Get one of a guild's settings, or an empty string if the guild hasn't set it
+	RetrieveGuildSetting(guildID string, columnName string) (string, error)
+	// Set one of a guild's settings, leaving the rest of them unchanged
+	UpdateGuildSetting(guildID string, columnName string, value string) error
+}
+
+// A MessageStore records the messages posted in each guild so reposts can be caught
+type MessageStore interface {
+	// Record a message along with the canonical forms of the links in it and the hashes of its images
+	RecordMessage(message *Message) error
+	// Find the first message in a guild that posted any of the links in a message, in their canonical forms, or nil
+	// if there isn't one.  Messages posted before since don't count.
+	DetectRepost(guildID string, urls []string, since time.Time) (*Message, error)
+	// Find the first message in a guild with an image whose hash is within maxDistance bits of one of hashes, or
+	// nil if there isn't one.  Messages posted before since don't count.
+	DetectImageRepost(guildID string, hashes []uint64, maxDistance int, since time.Time) (*Message, error)
+	// Move messages that don't belong to a guild into one, returning how many were moved
+	AssignUnscopedMessages(guildID string) (int64, error)
+
+	// Stop someone posting in a guild until a Penalty expires
+	CreatePenalty(penalty *Penalty) error
+	// Get the Penalty a user has in a guild that hasn't expired or been lifted by now, or nil if they don't have one
+	RetrievePenalty(guildID string, userID string, now time.Time) (*Penalty, error)
+	// Lift a user's Penalties in a guild early, returning how many were lifted
+	LiftPenalties(guildID string, userID string, now time.Time) (int64, error)
+
+	// Log that someone was caught reposting
+	RecordRepost(incident *RepostIncident) error
+	// Count a guild's reposts since a time, with the limit users and links that account for most of them and how
+	// many messages and reposts one user posted
+	RetrieveRepostStats(guildID string, userID string, since time.Time, limit int) (*RepostStats, error)
+}
+
+// Set up eventStore and messageStore with a backend: sqlite, postgres, or memory, which forgets everything when the
+// bot stops.  The sources are the SQLite files or PostgreSQL connection strings of the two databases.
+func OpenStores(backend string, eventsSource string, messagesSource string) error {
+	var driver string
+	switch backend {
+	case "memory":
+		eventStore = NewMemoryEventStore()
+		messageStore = NewMemoryMessageStore()
+		return nil
+	case "sqlite":
+		driver = "sqlite3"
+	case "postgres":
+		driver = "postgres"
+	default:
+		return errors.New("unknown backend " + backend + ", use sqlite, postgres or memory")
+	}
+
+	eventDB, err := OpenDB(driver, eventsSource, "events")
+	if err != nil {
+		return errors.New("events database: " + err.Error())
+	}
+	messageDB, err := OpenDB(driver, messagesSource, "messages")
+	if err != nil {
+		return errors.New("messages database: " + err.Error())
+	}
+
+	eventStore = &SQLEventStore{eventDB}
+	messageStore = &SQLMessageStore{messageDB}
+	return nil
+}
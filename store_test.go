@@ -0,0 +1,425 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// Run a test against a fresh eventStore and messageStore for each backend that works without a server
+func forEachStore(t *testing.T, test func(t *testing.T)) {
+	for _, backend := range []string{"memory", "sqlite"} {
+		t.Run(backend, func(t *testing.T) {
+			dir := t.TempDir()
+			err := OpenStores(backend, filepath.Join(dir, "events.sqlite"), filepath.Join(dir, "messages.sqlite"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			test(t)
+		})
+	}
+}
+
+// Create an Event for a test, failing it if the Event can't be created
+func createTestEvent(t *testing.T, guildID string, name string, startsAt time.Time, maxAttendees int64,
+	creatorID string) *Event {
+	event, err := eventStore.CreateEvent(guildID, name, "", "Park", startsAt, "UTC", maxAttendees, "creator",
+		creatorID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return event
+}
+
+func TestPromoteWaitlist(t *testing.T) {
+	cases := []struct {
+		name         string
+		maxAttendees int64
+		going        []string // who RSVPs Going, in order, so everyone past maxAttendees is waitlisted
+		change       func(eventID string, rsvps []*RSVP) error
+		want         []string // who comes off the waitlist
+	}{
+		{
+			name:         "someone going cancels",
+			maxAttendees: 1,
+			going:        []string{"a", "b", "c"},
+			change: func(eventID string, rsvps []*RSVP) error {
+				_, err := eventStore.UpdateRSVP(strconv.FormatInt(rsvps[0].id, 10), "Not going")
+				return err
+			},
+			want: []string{"b"},
+		},
+		{
+			name:         "someone waitlisted cancels",
+			maxAttendees: 1,
+			going:        []string{"a", "b", "c"},
+			change: func(eventID string, rsvps []*RSVP) error {
+				_, err := eventStore.UpdateRSVP(strconv.FormatInt(rsvps[1].id, 10), "Not going")
+				return err
+			},
+			want: nil,
+		},
+		{
+			name:         "capacity increase",
+			maxAttendees: 1,
+			going:        []string{"a", "b", "c"},
+			change: func(eventID string, rsvps []*RSVP) error {
+				return eventStore.UpdateEventColumns(eventID, []ColumnChange{{"max_attendees", 2}}, "creator")
+			},
+			want: []string{"b"},
+		},
+		{
+			name:         "limit removed",
+			maxAttendees: 1,
+			going:        []string{"a", "b", "c"},
+			change: func(eventID string, rsvps []*RSVP) error {
+				return eventStore.UpdateEventColumns(eventID, []ColumnChange{{"max_attendees", 0}}, "creator")
+			},
+			want: []string{"b", "c"},
+		},
+		{
+			name:         "still full",
+			maxAttendees: 2,
+			going:        []string{"a", "b", "c"},
+			change: func(eventID string, rsvps []*RSVP) error {
+				return nil
+			},
+			want: nil,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			forEachStore(t, func(t *testing.T) {
+				event := createTestEvent(t, "guild", "Board Games", time.Now().Add(time.Hour), c.maxAttendees, "1")
+				eventID := strconv.FormatInt(event.id, 10)
+
+				var rsvps []*RSVP
+				for i, userID := range c.going {
+					rsvp, err := eventStore.CreateRSVP(eventID, 0, userID, userID, "Going")
+					if err != nil {
+						t.Fatal(err)
+					}
+					if want := i >= int(c.maxAttendees); (rsvp.status == "Waitlisted") != want {
+						t.Fatalf("%s RSVPed %s", userID, rsvp.status)
+					}
+					rsvps = append(rsvps, rsvp)
+				}
+
+				if err := c.change(eventID, rsvps); err != nil {
+					t.Fatal(err)
+				}
+				promoted, err := eventStore.PromoteWaitlist(eventID, 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				var got []string
+				for _, rsvp := range promoted {
+					got = append(got, rsvp.userID)
+				}
+				if fmt.Sprint(got) != fmt.Sprint(c.want) {
+					t.Fatalf("promoted %v, want %v", got, c.want)
+				}
+
+				// Everyone promoted is now going, and is recorded in the Event's history as coming off the waitlist
+				history, err := eventStore.RetrieveHistory(event.id, historyLimit)
+				if err != nil {
+					t.Fatal(err)
+				}
+				promotions := 0
+				for _, entry := range history {
+					if entry.action == AuditRSVP && entry.oldValue == "Waitlisted" && entry.newValue == "Going" {
+						promotions++
+					}
+				}
+				if promotions != len(c.want) {
+					t.Fatalf("%d promotions recorded, want %d", promotions, len(c.want))
+				}
+			})
+		})
+	}
+}
+
+func TestListEvents(t *testing.T) {
+	forEachStore(t, func(t *testing.T) {
+		now := time.Now().Truncate(time.Second)
+		for i := 1; i <= 12; i++ {
+			creatorID := "1"
+			if i == 12 {
+				creatorID = "2"
+			}
+			createTestEvent(t, "guild", fmt.Sprintf("Event %02d", i), now.Add(time.Duration(i)*time.Hour), 0,
+				creatorID)
+		}
+		createTestEvent(t, "guild", "Old 1", now.Add(-time.Hour), 0, "1")
+		createTestEvent(t, "guild", "Old 2", now.Add(-2*time.Hour), 0, "1")
+		createTestEvent(t, "other", "Elsewhere", now.Add(time.Hour), 0, "1")
+
+		cancelled := createTestEvent(t, "guild", "Called Off", now.Add(30*time.Minute), 0, "1")
+		if err := eventStore.CancelEvent(strconv.FormatInt(cancelled.id, 10), "", now, "1"); err != nil {
+			t.Fatal(err)
+		}
+
+		going, _ := eventStore.RetrieveEventByName("guild", "Event 03")
+		notGoing, _ := eventStore.RetrieveEventByName("guild", "Event 05")
+		if len(going) != 1 || len(notGoing) != 1 {
+			t.Fatal(going, notGoing)
+		}
+		eventStore.CreateRSVP(strconv.FormatInt(going[0].id, 10), 0, "user", "user", "Going")
+		eventStore.CreateRSVP(strconv.FormatInt(notGoing[0].id, 10), 0, "user", "user", "Not going")
+
+		series := createTestEvent(t, "series", "Daily Standup", now.Add(time.Hour), 0, "1")
+		rule, _ := ParseRRule("FREQ=DAILY", time.UTC)
+		if err := UpdateEventRecurrence(strconv.FormatInt(series.id, 10), rule, "1"); err != nil {
+			t.Fatal(err)
+		}
+
+		cases := []struct {
+			name      string
+			filter    EventFilter
+			page      int
+			wantCount int
+			wantMore  bool
+			wantFirst string
+		}{
+			{"first page", EventFilter{guildID: "guild"}, 1, 10, true, "Event 01"},
+			{"last page", EventFilter{guildID: "guild"}, 2, 2, false, "Event 11"},
+			{"past the end", EventFilter{guildID: "guild"}, 3, 0, false, ""},
+			{"past events", EventFilter{guildID: "guild", past: true}, 1, 2, false, "Old 1"},
+			{"created by", EventFilter{guildID: "guild", creatorID: "2"}, 1, 1, false, "Event 12"},
+			{"RSVPed to", EventFilter{guildID: "guild", rsvpUserID: "user"}, 1, 1, false, "Event 03"},
+			{"other guild", EventFilter{guildID: "other"}, 1, 1, false, "Elsewhere"},
+			{"recurring", EventFilter{guildID: "series"}, 2, 10, true, "Daily Standup"},
+		}
+
+		for _, c := range cases {
+			events, more, err := ListEvents(c.filter, now, c.page)
+			if err != nil {
+				t.Fatal(c.name, err)
+			}
+			if len(events) != c.wantCount || more != c.wantMore {
+				t.Fatalf("%s: got %d events and more=%v, want %d and more=%v", c.name, len(events), more,
+					c.wantCount, c.wantMore)
+			}
+			if len(events) > 0 && events[0].name != c.wantFirst {
+				t.Fatalf("%s: first event is %s, want %s", c.name, events[0].name, c.wantFirst)
+			}
+		}
+	})
+}
+
+func TestOccurrenceExceptions(t *testing.T) {
+	start := time.Date(2030, time.January, 7, 19, 0, 0, 0, time.UTC)
+	week := 7 * 24 * time.Hour
+
+	cases := []struct {
+		name         string
+		week         int // which occurrence of the weekly series is changed
+		changes      []ColumnChange
+		wantShown    bool
+		wantStartsAt time.Time
+		wantLocation string
+	}{
+		{"unchanged", 0, nil, true, start, "Park"},
+		{"cancelled", 1, []ColumnChange{{"cancelled", 1}}, false, time.Time{}, ""},
+		{"moved", 2, []ColumnChange{{"starts_at", start.Add(2*week + 24*time.Hour).Unix()}, {"location", "Pub"}},
+			true, start.Add(2*week + 24*time.Hour), "Pub"},
+		{"described", 3, []ColumnChange{{"description", "Bring snacks"}}, true, start.Add(3 * week), "Park"},
+	}
+
+	forEachStore(t, func(t *testing.T) {
+		series := createTestEvent(t, "guild", "Trivia", start, 0, "1")
+		rule, _ := ParseRRule("FREQ=WEEKLY", time.UTC)
+		if err := UpdateEventRecurrence(strconv.FormatInt(series.id, 10), rule, "1"); err != nil {
+			t.Fatal(err)
+		}
+		series, _ = eventStore.RetrieveEventByID(strconv.FormatInt(series.id, 10))
+
+		for _, c := range cases {
+			if c.changes == nil {
+				continue
+			}
+			occurrence := start.Add(time.Duration(c.week) * week).Unix()
+			if err := eventStore.UpdateOccurrenceColumns(series.id, occurrence, c.changes, "1"); err != nil {
+				t.Fatal(c.name, err)
+			}
+		}
+
+		occurrences, err := ExpandEvent(series, start, start.Add(time.Duration(len(cases))*week), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		shown := make(map[int64]*Event)
+		for _, occurrence := range occurrences {
+			shown[occurrence.occurrence] = occurrence
+		}
+
+		for _, c := range cases {
+			occurrence, ok := shown[start.Add(time.Duration(c.week)*week).Unix()]
+			if ok != c.wantShown {
+				t.Fatalf("%s: shown=%v, want %v", c.name, ok, c.wantShown)
+			}
+			if !ok {
+				continue
+			}
+			if !occurrence.startsAt.Equal(c.wantStartsAt) || occurrence.location != c.wantLocation {
+				t.Fatalf("%s: %v at %s, want %v at %s", c.name, occurrence.startsAt, occurrence.location,
+					c.wantStartsAt, c.wantLocation)
+			}
+		}
+	})
+}
+
+func TestDetectRepost(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+
+	cases := []struct {
+		name    string
+		guildID string
+		urls    []string
+		since   time.Time
+		want    string // the ID of the message that was reposted, or empty if it isn't a repost
+	}{
+		{"inside the window", "guild", []string{"https://example.com/a"}, now.Add(-3 * time.Hour), "old"},
+		{"outside the window", "guild", []string{"https://example.com/a"}, now.Add(-time.Hour), ""},
+		{"recent post", "guild", []string{"https://example.com/b"}, now.Add(-time.Hour), "recent"},
+		{"one of several links", "guild", []string{"https://example.com/c", "https://example.com/b"},
+			now.Add(-time.Hour), "recent"},
+		{"new link", "guild", []string{"https://example.com/c"}, now.Add(-3 * time.Hour), ""},
+		{"other guild", "other", []string{"https://example.com/a"}, now.Add(-3 * time.Hour), ""},
+	}
+
+	forEachStore(t, func(t *testing.T) {
+		messages := []*Message{
+			{guildID: "guild", channelID: "channel", discordMessageID: "old", authorID: "a",
+				content: "https://example.com/a", postedAt: now.Add(-2 * time.Hour),
+				urls: []string{"https://example.com/a"}},
+			{guildID: "guild", channelID: "channel", discordMessageID: "recent", authorID: "b",
+				content: "https://example.com/b", postedAt: now.Add(-time.Minute),
+				urls: []string{"https://example.com/b"}},
+		}
+		for _, message := range messages {
+			if err := messageStore.RecordMessage(message); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		for _, c := range cases {
+			original, err := messageStore.DetectRepost(c.guildID, c.urls, c.since)
+			if err != nil {
+				t.Fatal(c.name, err)
+			}
+			got := ""
+			if original != nil {
+				got = original.discordMessageID
+			}
+			if got != c.want {
+				t.Fatalf("%s: got %q, want %q", c.name, got, c.want)
+			}
+		}
+	})
+}
+
+func TestDetectImageRepost(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+
+	cases := []struct {
+		name   string
+		hashes []uint64
+		since  time.Time
+		want   string // the ID of the message that was reposted, or empty if it isn't a repost
+	}{
+		{"same image", []uint64{0xff00}, time.Time{}, "first"},
+		{"similar image", []uint64{0xff03}, time.Time{}, "first"},
+		{"different image", []uint64{0x00ff}, time.Time{}, ""},
+		{"first post outside the window", []uint64{0xff00}, now.Add(-time.Hour), "second"},
+		{"both outside the window", []uint64{0xff00}, now, ""},
+	}
+
+	forEachStore(t, func(t *testing.T) {
+		messages := []*Message{
+			{guildID: "guild", channelID: "channel", discordMessageID: "first", authorID: "a",
+				postedAt: now.Add(-2 * time.Hour), imageHashes: []uint64{0xff00}},
+			{guildID: "guild", channelID: "channel", discordMessageID: "second", authorID: "b",
+				postedAt: now.Add(-time.Minute), imageHashes: []uint64{0xff01}},
+		}
+		for _, message := range messages {
+			if err := messageStore.RecordMessage(message); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		for _, c := range cases {
+			original, err := messageStore.DetectImageRepost("guild", c.hashes, 2, c.since)
+			if err != nil {
+				t.Fatal(c.name, err)
+			}
+			got := ""
+			if original != nil {
+				got = original.discordMessageID
+			}
+			if got != c.want {
+				t.Fatalf("%s: got %q, want %q", c.name, got, c.want)
+			}
+		}
+	})
+}
+
+func TestPenalties(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+
+	cases := []struct {
+		name       string
+		userID     string
+		at         time.Time
+		wantReason string // the reason for the Penalty in force, or empty if there isn't one
+	}{
+		{"during the penalty", "user", now, "longer"},
+		{"after the shorter penalty", "user", now.Add(90 * time.Minute), "longer"},
+		{"after both penalties", "user", now.Add(3 * time.Hour), ""},
+		{"someone else", "other", now, ""},
+	}
+
+	forEachStore(t, func(t *testing.T) {
+		penalties := []*Penalty{
+			{guildID: "guild", userID: "user", reason: "shorter", startedAt: now, expiresAt: now.Add(time.Hour)},
+			{guildID: "guild", userID: "user", reason: "longer", startedAt: now, expiresAt: now.Add(2 * time.Hour)},
+			{guildID: "guild", userID: "expired", reason: "old", startedAt: now.Add(-2 * time.Hour),
+				expiresAt: now.Add(-time.Hour)},
+		}
+		for _, penalty := range penalties {
+			if err := messageStore.CreatePenalty(penalty); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		for _, c := range cases {
+			penalty, err := messageStore.RetrievePenalty("guild", c.userID, c.at)
+			if err != nil {
+				t.Fatal(c.name, err)
+			}
+			got := ""
+			if penalty != nil {
+				got = penalty.reason
+			}
+			if got != c.wantReason {
+				t.Fatalf("%s: got %q, want %q", c.name, got, c.wantReason)
+			}
+		}
+
+		// Lifting penalties only lifts the ones still in force
+		lifted, err := messageStore.LiftPenalties("guild", "user", now)
+		if err != nil || lifted != 2 {
+			t.Fatal(lifted, err)
+		}
+		if lifted, _ := messageStore.LiftPenalties("guild", "expired", now); lifted != 0 {
+			t.Fatal(lifted)
+		}
+		if penalty, _ := messageStore.RetrievePenalty("guild", "user", now); penalty != nil {
+			t.Fatal(penalty)
+		}
+	})
+}